@@ -0,0 +1,153 @@
+package ttlcache
+
+import (
+	"math"
+	"time"
+)
+
+// Entry - A record for the batch functions
+type Entry struct {
+	Key   interface{}
+	Value interface{}
+	TTL   time.Duration
+}
+
+// WriteBatch - Write many records to the cache, taking every partition lock only once
+// Returns the number of records stored, records not fitting their partition are dropped like in Write
+func WriteBatch(entries []Entry, masterKey string) int {
+	z := lookup(masterKey)
+	if z == nil {
+		return 0
+	}
+	size := z.entries()
+	stored := 0
+	for n, group := range z.group(entries) {
+		var evicted []KV
+		values := n.prepareAll(group)
+		n.Lock()
+		for i, e := range group {
+			ok, ev := n.store(e.Key, values[i], e.TTL, size)
+			if ok {
+				stored++
+			}
+			evicted = append(evicted, ev...)
+		}
+		n.Unlock()
+		z.evictedForRoom(evicted)
+	}
+	return stored
+}
+
+// PreloadUnchecked - Write many records to a masterKey without checking its max entries, for warming a cache from a trusted snapshot
+// Only safe on an empty (just initialized) masterKey before other writes: The maps of empty partitions are sized for the records up front
+// and partitions can end up above their max entries, after which they drop (or evict for) new keys until enough records expire.
+// MaxBytes is still enforced. Returns the number of records stored
+func PreloadUnchecked(entries []Entry, masterKey string) int {
+	z := lookup(masterKey)
+	if z == nil {
+		return 0
+	}
+	stored := 0
+	for n, group := range z.group(entries) {
+		var evicted []KV
+		values := n.prepareAll(group)
+		n.Lock()
+		if n.dataSets == nil {
+			n.dataSets = make(map[interface{}]interface{}, max(len(group), n.capacity))
+			n.dataManagement = make(map[interface{}]*data, max(len(group), n.capacity))
+		}
+		for i, e := range group {
+			ok, ev := n.store(e.Key, values[i], e.TTL, math.MaxInt)
+			if ok {
+				stored++
+			}
+			evicted = append(evicted, ev...)
+		}
+		n.Unlock()
+		z.evictedForRoom(evicted)
+	}
+	return stored
+}
+
+// group - Groups records by their partition for a write, records without partition (or rejected by StrictKeys) are skipped
+func (z *mainData) group(entries []Entry) map[*ttlManagement][]Entry {
+	groups := make(map[*ttlManagement][]Entry)
+	for _, e := range entries {
+		if n, key, err := z.writable(e.Key); err == nil {
+			e.Key = key
+			groups[n] = append(groups[n], e)
+		}
+	}
+	return groups
+}
+
+// prepareAll - Prepares the values of a group of records before the partition lock is taken, see prepare
+func (n *ttlManagement) prepareAll(group []Entry) []prepared {
+	values := make([]prepared, len(group))
+	for i, e := range group {
+		values[i] = n.prepare(e.Value)
+	}
+	return values
+}
+
+// groupKeys - Groups keys by their partition, keys without partition are skipped
+func (z *mainData) groupKeys(keys []interface{}) map[*ttlManagement][]interface{} {
+	groups := make(map[*ttlManagement][]interface{})
+	for _, k := range keys {
+		if n, key := z.partition(k); n != nil {
+			groups[n] = append(groups[n], key)
+		}
+	}
+	return groups
+}
+
+// ReadMulti - read many keys from the cache, taking the read lock of every involved partition only once
+// The result only holds the keys which were found, like Read without exact key expiration
+func ReadMulti(keys []interface{}, masterKey string) (map[interface{}]interface{}, error) {
+	z := lookup(masterKey)
+	if z == nil {
+		return nil, errCacheNotInitialized
+	}
+	found := make(map[interface{}]interface{}, len(keys))
+	for n, group := range z.groupKeys(keys) {
+		n.readLock()
+		for _, k := range group {
+			if v := n.dataSets[k]; v != nil && v != negative && n.valid(k, v) {
+				found[k] = v
+				n.used(k)
+			}
+		}
+		n.readUnlock()
+	}
+	if z.clone != nil {
+		for k, v := range found {
+			found[k] = z.clone(v)
+		}
+	}
+	return found, nil
+}
+
+// DeleteMulti - Removes many keys from the cache, taking the lock of every involved partition only once
+// Returns the number of keys actually removed, keys which were not in the cache are skipped
+func DeleteMulti(keys []interface{}, masterKey string) int {
+	z := lookup(masterKey)
+	if z == nil {
+		return 0
+	}
+	count := 0
+	for n, group := range z.groupKeys(keys) {
+		var removed []KV
+		n.Lock()
+		for _, k := range group {
+			if v, ok := n.remove(k); ok {
+				count++
+				if z.onEvict != nil {
+					removed = append(removed, KV{k, v})
+				}
+			}
+		}
+		n.Unlock()
+		z.evicted(removed)
+	}
+	return count
+}
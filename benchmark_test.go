@@ -0,0 +1,281 @@
+package ttlcache
+
+import (
+	"runtime"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// prefixedKeys - Keys sharing a prefix, like the "user:" keys of many applications
+func prefixedKeys(n int) []string {
+	keys := make([]string, n)
+	for i := range keys {
+		keys[i] = "user:" + strconv.Itoa(i)
+	}
+	return keys
+}
+
+// reportSpread - Reports how the keys of masterKey are spread over its partitions
+func reportSpread(b *testing.B, masterKey string) {
+	used, largest := 0, 0
+	for _, n := range StatsSnapshot(masterKey).Partitions {
+		if n > 0 {
+			used++
+		}
+		largest = max(largest, n)
+	}
+	b.ReportMetric(float64(used), "partitions-used")
+	b.ReportMetric(float64(largest), "max-keys/partition")
+}
+
+// BenchmarkPartitionSpread - Reads of prefixed keys with the partition selected by the first key byte and by HashKeys
+// The first byte puts all keys in one partition, so reads and writes contend for one lock and the partition fills first
+func BenchmarkPartitionSpread(b *testing.B) {
+	keys := prefixedKeys(100000)
+	for _, bc := range []struct {
+		name string
+		opts []Option
+	}{
+		{"FirstByte", nil},
+		{"HashKeys", []Option{HashKeys()}},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			masterKey := initTest(b, len(keys), bc.opts...)
+			for _, k := range keys {
+				Write(k, k, time.Hour, masterKey)
+			}
+			b.ResetTimer()
+			for i := range b.N {
+				Read(keys[i%len(keys)], masterKey)
+			}
+			b.StopTimer()
+			reportSpread(b, masterKey)
+		})
+	}
+}
+
+// BenchmarkWarmUp - The first write to every partition of a new masterKey, which creates the partition maps without WarmUp
+func BenchmarkWarmUp(b *testing.B) {
+	for _, warm := range []bool{false, true} {
+		name := "Cold"
+		if warm {
+			name = "Warm"
+		}
+		b.Run(name, func(b *testing.B) {
+			masterKey := b.Name()
+			for range b.N {
+				b.StopTimer()
+				InitCache(100, masterKey, nil)
+				if warm {
+					WarmUp(masterKey)
+				}
+				b.StartTimer()
+				// Sequential ints spread over all 256 partitions by their first byte
+				for k := range 256 {
+					Write(k, k, time.Hour, masterKey)
+				}
+				b.StopTimer()
+				DropCache(masterKey)
+				b.StartTimer()
+			}
+			b.ReportMetric(float64(b.Elapsed().Nanoseconds())/float64(b.N*256), "ns/write")
+		})
+	}
+}
+
+// BenchmarkReadWhileWriting - Parallel reads while a writer keeps changing the cache, with the partition RWMutex and with CopyOnWrite
+func BenchmarkReadWhileWriting(b *testing.B) {
+	const keys = 10000
+	for _, bc := range []struct {
+		name string
+		opts []Option
+	}{
+		{"RWMutex", nil},
+		{"CopyOnWrite", []Option{CopyOnWrite()}},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			masterKey := initTest(b, keys, bc.opts...)
+			for k := range keys {
+				Write(k, k, time.Hour, masterKey)
+			}
+			stop, done := make(chan struct{}), make(chan struct{})
+			go func() {
+				defer close(done)
+				for i := 0; ; i++ {
+					select {
+					case <-stop:
+						return
+					default:
+					}
+					Write(i%keys, i, time.Hour, masterKey)
+				}
+			}()
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				i := 0
+				for pb.Next() {
+					Read(i%keys, masterKey)
+					i += 7
+				}
+			})
+			b.StopTimer()
+			close(stop)
+			<-done
+		})
+	}
+}
+
+// sweepEntries - Records of the sweep benchmarks
+const sweepEntries = 1 << 20
+
+// fullScan - The sweep as it was before the expiry heap: Every record of every partition is checked, returns the expired ones
+func fullScan(z *mainData) (expired int) {
+	for _, n := range z.data {
+		n.RLock()
+		for _, d := range n.dataManagement {
+			if d.expired() {
+				expired++
+			}
+		}
+		n.RUnlock()
+	}
+	return expired
+}
+
+// BenchmarkSweep - A sweep of 1M records with ttls between 1 and 24 hours, so none are due: The expiry heap only looks at the first
+// record of every partition, the full scan checks all of them
+func BenchmarkSweep(b *testing.B) {
+	masterKey := initTest(b, sweepEntries/256)
+	for k := range sweepEntries {
+		Write(k, k, time.Duration(1+k%24)*time.Hour, masterKey)
+	}
+	z := lookup(masterKey)
+	b.Run("Heap", func(b *testing.B) {
+		for range b.N {
+			z.sweep()
+		}
+	})
+	b.Run("FullScan", func(b *testing.B) {
+		for range b.N {
+			fullScan(z)
+		}
+	})
+}
+
+// BenchmarkSweepWorkers - Wall clock time of a sweep removing 1M expired records, one partition at a time and with a worker per CPU
+// Only differs on machines with more than one CPU, since the workers are capped at GOMAXPROCS
+func BenchmarkSweepWorkers(b *testing.B) {
+	entries := make([]Entry, sweepEntries)
+	for k := range entries {
+		entries[k] = Entry{Key: k, Value: k, TTL: time.Minute}
+	}
+	for _, bc := range []struct {
+		name    string
+		workers int
+	}{
+		{"Serial", 1},
+		{"Parallel", runtime.GOMAXPROCS(0)},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			advance := fakeClock(b)
+			masterKey := initTest(b, sweepEntries/256, SweepWorkers(bc.workers))
+			for range b.N {
+				b.StopTimer()
+				WriteBatch(entries, masterKey)
+				advance(2 * time.Minute)
+				b.StartTimer()
+				Sweep(masterKey)
+			}
+			b.StopTimer()
+			if Len(masterKey) != 0 {
+				b.Fatalf("%d records left after the sweep", Len(masterKey))
+			}
+		})
+	}
+}
+
+// BenchmarkInitialCapacity - Filling a partition up to its max entries, with maps growing from empty and sized up front
+func BenchmarkInitialCapacity(b *testing.B) {
+	const entries = 10000
+	for _, bc := range []struct {
+		name string
+		opts []Option
+	}{
+		{"NoHint", []Option{Partitions(1)}},
+		{"Hint", []Option{Partitions(1), InitialCapacity(entries)}},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			masterKey := b.Name()
+			b.ReportAllocs()
+			for range b.N {
+				b.StopTimer()
+				InitCache(entries, masterKey, nil, bc.opts...)
+				b.StartTimer()
+				for k := range entries {
+					Write(k, k, time.Hour, masterKey)
+				}
+				b.StopTimer()
+				DropCache(masterKey)
+				b.StartTimer()
+			}
+		})
+	}
+}
+
+// strconvKeys - The naive KeyToByte of int keys, for comparison with IntKeys
+type strconvKeys struct{}
+
+func (strconvKeys) KeyToByte(key interface{}) []byte {
+	return []byte(strconv.Itoa(key.(int)))
+}
+
+// BenchmarkIntKeys - KeyToByte of int keys by IntKeys and by formatting them with strconv
+func BenchmarkIntKeys(b *testing.B) {
+	for _, bc := range []struct {
+		name string
+		keys ttlFunctions
+	}{
+		{"IntKeys", IntKeys{}},
+		{"Strconv", strconvKeys{}},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := range b.N {
+				bc.keys.KeyToByte(i)
+			}
+		})
+	}
+}
+
+// BenchmarkPreload - Warming a new masterKey with 100k records by WriteBatch and by PreloadUnchecked
+func BenchmarkPreload(b *testing.B) {
+	entries := make([]Entry, 100000)
+	for k := range entries {
+		entries[k] = Entry{Key: k, Value: k, TTL: time.Hour}
+	}
+	for _, bc := range []struct {
+		name    string
+		preload func([]Entry, string) int
+	}{
+		{"WriteBatch", WriteBatch},
+		{"PreloadUnchecked", PreloadUnchecked},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			masterKey := b.Name()
+			b.ReportAllocs()
+			for range b.N {
+				b.StopTimer()
+				// Room for every record, so WriteBatch stores all of them too
+				InitCache(len(entries)/256+1, masterKey, nil)
+				b.StartTimer()
+				if n := bc.preload(entries, masterKey); n != len(entries) {
+					b.Fatalf("%d of %d records stored", n, len(entries))
+				}
+				b.StopTimer()
+				DropCache(masterKey)
+				b.StartTimer()
+			}
+		})
+	}
+}
@@ -0,0 +1,36 @@
+package ttlcache
+
+import (
+	"bytes"
+	"time"
+)
+
+// WriteBytes - Write a []byte value to the byte store of a masterKey
+// The byte store is a parallel store next to the interface{} values of the masterKey, storing the value without interface boxing.
+// It has its own max entries per partition (the max of the masterKey) and always uses the first key byte as partition.
+// value is stored as is, so the caller should not change it after writing
+func WriteBytes(key interface{}, value []byte, ttl time.Duration, masterKey string) {
+	z := lookup(masterKey)
+	if z == nil || z.frozen.Load() || !hashable(key) {
+		return
+	}
+	z.bytes.Write(key, value, ttl)
+}
+
+// ReadBytes - read a key from the byte store of a masterKey, without exact key expiration like Read
+// Values written with Write are not in the byte store, and values written with WriteBytes can only be read with ReadBytes.
+// The stored slice itself is returned: A caller changing it changes the cached value for all readers, unless the masterKey uses CopyOnRead
+func ReadBytes(key interface{}, masterKey string) ([]byte, error) {
+	z := lookup(masterKey)
+	if z == nil {
+		return nil, errCacheNotInitialized
+	}
+	if !hashable(key) {
+		return nil, errInvalidKey
+	}
+	v, err := z.bytes.Read(key)
+	if err != nil || !z.copyOnRead {
+		return v, err
+	}
+	return bytes.Clone(v), nil
+}
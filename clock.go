@@ -0,0 +1,35 @@
+package ttlcache
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// clock - Source of the current time for all ttl checks, replaceable with SetClock
+var clock atomic.Pointer[func() time.Time]
+
+// SetClock - Replaces the time source of all caches, so tests can advance time and expire records without sleeping
+// The expire go routines keep ticking in real time but check the ttls against the clock, call Sweep to remove the records expired
+// by moving the clock right away. Pass nil to restore time.Now
+func SetClock(fn func() time.Time) {
+	if fn == nil {
+		clock.Store(nil)
+		return
+	}
+	clock.Store(&fn)
+}
+
+// now - The current time of the clock, without its monotonic reading
+// The expiry heap orders records by wall clock deadlines, so setTime and the ttl checks use the wall clock as well: Mixing in the
+// monotonic clock makes a record due in the heap while it is not expired after the wall clock is stepped (NTP, resume from suspend)
+func now() time.Time {
+	if fn := clock.Load(); fn != nil {
+		return (*fn)().Round(0)
+	}
+	return time.Now().Round(0)
+}
+
+// since - The time elapsed since t according to the clock
+func since(t time.Time) time.Duration {
+	return now().Sub(t)
+}
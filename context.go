@@ -0,0 +1,68 @@
+package ttlcache
+
+import "context"
+
+// ReadContext - read a key from the cache like Read, giving up with ctx.Err() when ctx is done before the partition lock is taken
+// Waits for the partition lock in line with Read and the writes, so it is not starved under contention
+func ReadContext(ctx context.Context, key interface{}, masterKey string) (interface{}, error) {
+	z := lookup(masterKey)
+	if z == nil {
+		return nil, errCacheNotInitialized
+	}
+	q, key := z.partition(key)
+	if q == nil {
+		z.misses.Add(1)
+		return nil, errKeyNotFound
+	}
+	if q.counting {
+		q.reads.Add(1)
+	}
+	if err := q.readLockContext(ctx); err != nil {
+		return nil, err
+	}
+	v := q.dataSets[key]
+	if v != nil && !q.valid(key, v) {
+		v = nil
+	}
+	if v != nil {
+		q.used(key)
+	}
+	q.readUnlock()
+	if v == nil {
+		q.misses.Add(1)
+		return nil, errKeyNotFound
+	}
+	q.hits.Add(1)
+	return q.found(v)
+}
+
+// readLockContext - Takes the readLock, giving up with ctx.Err() when ctx is done first
+// When it gives up, the lock is still taken in the background and released right away, as a sync.RWMutex can not leave its queue
+func (n *ttlManagement) readLockContext(ctx context.Context) error {
+	try := n.TryRLock
+	if n.order != nil {
+		try = n.TryLock
+	}
+	if try() {
+		return nil
+	}
+	if ctx.Done() == nil {
+		n.readLock()
+		return nil
+	}
+	acquired := make(chan struct{})
+	go func() {
+		n.readLock()
+		select {
+		case acquired <- struct{}{}:
+		case <-ctx.Done():
+			n.readUnlock()
+		}
+	}()
+	select {
+	case <-acquired:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
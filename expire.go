@@ -0,0 +1,176 @@
+package ttlcache
+
+import (
+	"runtime"
+	"sync"
+	"time"
+)
+
+// sweepBatch - Number of records removed per lock of a partition during a sweep
+const sweepBatch = 1024
+
+// Shutdown - Stops the background expire go routines and waits for them to return
+// After Shutdown expired data is no longer removed from the cache, calling Shutdown more than once is safe
+func Shutdown() {
+	stopOnce.Do(func() {
+		close(stop)
+	})
+	expiring.Wait()
+}
+
+// Sweep - Removes the expired records of the masterKey now instead of at the next expire interval, like the expire go routine does
+// Together with SetClock tests can expire records and check OnSweep or OnEvict without waiting. Returns ErrFrozen for a frozen masterKey
+func Sweep(masterKey string) error {
+	z := lookup(masterKey)
+	if z == nil {
+		return errCacheNotInitialized
+	}
+	if z.frozen.Load() {
+		return ErrFrozen
+	}
+	z.sweep()
+	return nil
+}
+
+// expire - Manages the expiration of data in the cache
+// expire is a go routine per masterKey which once per expireInterval checks the state of the cache, until Shutdown is called
+func (z *mainData) expire() {
+	defer expiring.Done()
+	t := time.NewTicker(z.expireInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-z.done:
+			return
+		case <-t.C:
+			if !z.frozen.Load() {
+				z.sweep()
+				if z.overMemoryLimit() {
+					z.shed()
+				}
+			}
+		}
+	}
+}
+
+// sweep - Removes all expired data of the masterKey from the cache
+// A panic while sweeping a partition (in an OnEvict callback for example) is logged and only skips the rest of that partition,
+// so a single bad record can not stop the expiration of the whole cache
+func (z *mainData) sweep() {
+	t := now()
+	var expired []KV
+	if workers := min(z.sweepWorkers, runtime.GOMAXPROCS(0)); workers > 1 {
+		expired = z.sweepParallel(workers, t)
+	} else {
+		for i, m := range z.data {
+			expired = append(expired, z.sweepPartition(i, m, t)...)
+		}
+	}
+	func() {
+		defer z.recovered(-1)
+		z.bytes.sweep()
+	}()
+	if z.onSweep != nil && len(expired) > 0 {
+		z.swept(expired)
+	}
+}
+
+// swept - Hands the records expired by a sweep to the OnSweep callback, logging a panic like the sweep itself
+func (z *mainData) swept(expired []KV) {
+	defer func() {
+		if r := recover(); r != nil {
+			logf("Master key: %s, recovered from panic in OnSweep: %v", z.masterKey, r)
+		}
+	}()
+	z.onSweep(z.masterKey, expired)
+}
+
+// sweepParallel - Sweeps the partitions with a pool of workers, each partition is handed to one worker (SweepWorkers)
+// Returns the expired records for OnSweep, like sweepPartition
+func (z *mainData) sweepParallel(workers int, t time.Time) []KV {
+	partitions := make(chan int)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var expired []KV
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range partitions {
+				if removed := z.sweepPartition(i, z.data[i], t); removed != nil {
+					mu.Lock()
+					expired = append(expired, removed...)
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+	for i := range z.data {
+		partitions <- i
+	}
+	close(partitions)
+	wg.Wait()
+	return expired
+}
+
+// sweepPartition - Removes the records of one partition which are expired at t
+// The expiry heap holds the records soonest expiry first, so only due records are visited instead of scanning the full partition.
+// The lock is released every sweepBatch records, so a large expiring batch does not block the partition for the full removal.
+// With OnSweep the expired records are returned, to hand them over in one batch per sweep
+func (z *mainData) sweepPartition(i int, m *ttlManagement, t time.Time) (expired []KV) {
+	defer z.recovered(i)
+	// The removed records are only collected when someone uses them
+	collect := z.onEvict != nil || z.onSweep != nil || z.subscribed()
+	for more := true; more; {
+		var removed []KV
+		stuck := false
+		m.Lock()
+		// A partition frozen during the sweep keeps its records
+		for j := 0; j < sweepBatch && !m.frozen && m.due(t); j++ {
+			d := m.expiry[0]
+			if !d.expired() {
+				// Read since it was scheduled (MaxIdle)
+				m.schedule(d)
+				if m.expiry[0] == d {
+					// Still due but not expired: Checking it again would never end, the next sweep picks it up
+					stuck = true
+					break
+				}
+				continue
+			}
+			value, ok := m.remove(d.key)
+			if !ok {
+				// Not expected, but a record missing from the partition must not keep the sweep looping
+				m.unschedule(d)
+			} else if collect {
+				removed = append(removed, KV{d.key, value})
+			}
+		}
+		more = !stuck && !m.frozen && m.due(t)
+		if !more {
+			m.compact()
+		}
+		m.Unlock()
+		z.evicted(removed)
+		z.notify(removed)
+		if z.onSweep != nil {
+			for _, kv := range removed {
+				// Keys cached as missing have no value to hand over, like for OnEvict
+				if kv.Value != negative {
+					expired = append(expired, kv)
+				}
+			}
+		}
+	}
+	return expired
+}
+
+// recovered - Logs a panic of the sweep instead of letting it end the expire go routine, use with defer
+// partition -1 is the byte store
+func (z *mainData) recovered(partition int) {
+	if r := recover(); r != nil {
+		logf("Master key: %s, partition %d, recovered from panic in sweep: %v", z.masterKey, partition, r)
+	}
+}
@@ -0,0 +1,27 @@
+package ttlcache
+
+// Freeze - Makes a masterKey read only, for a stable cache during maintenance like a bulk reindex or a graceful shutdown
+// While frozen all writes and deletes are ignored (WriteChecked, Delete, Touch, Replace and Flush return ErrFrozen), the sweep is paused
+// and reads keep serving the data, including records whose ttl passes during the freeze. When Freeze returns no write is in progress
+func Freeze(masterKey string) {
+	setFrozen(masterKey, true)
+}
+
+// Unfreeze - Makes a frozen masterKey writable again, the next sweep removes the records which expired during the freeze
+func Unfreeze(masterKey string) {
+	setFrozen(masterKey, false)
+}
+
+// setFrozen - Sets the frozen state of a masterKey and all its partitions, taking every partition lock to wait for running writes
+func setFrozen(masterKey string, frozen bool) {
+	z := lookup(masterKey)
+	if z == nil {
+		return
+	}
+	z.frozen.Store(frozen)
+	for _, n := range z.data {
+		n.Lock()
+		n.frozen = frozen
+		n.Unlock()
+	}
+}
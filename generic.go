@@ -0,0 +1,159 @@
+package ttlcache
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Cache - Typed cache with the same partitioning and expiration as the masterKey caches
+// Values are stored as V instead of interface{}, so reads need no type assertion and values are not boxed
+type Cache[K comparable, V any] struct {
+	keyToByte func(K) []byte
+	// size - Max entries per partition, atomic since Resize changes it while writes read it
+	size atomic.Int64
+	// 256 memory partitions (1 byte)
+	data      [256]*partition[K, V]
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+type partition[K comparable, V any] struct {
+	sync.RWMutex
+	dataSets       map[K]V
+	dataManagement map[K]*data
+	keys           int
+}
+
+// NewCache - Creates a typed cache with max entries per partition
+// keyToByte has the same role as KeyToByte in ttlFunctions: Its first byte selects the partition
+func NewCache[K comparable, V any](entries int, keyToByte func(K) []byte) *Cache[K, V] {
+	c := newCache[K, V](entries, keyToByte)
+	expiring.Add(1)
+	go c.expire()
+	return c
+}
+
+// newCache - Creates a typed cache without expire go routine, for caches swept by their owner
+func newCache[K comparable, V any](entries int, keyToByte func(K) []byte) *Cache[K, V] {
+	c := &Cache[K, V]{keyToByte: keyToByte, done: make(chan struct{})}
+	c.size.Store(int64(entries))
+	for i := range c.data {
+		c.data[i] = &partition[K, V]{}
+	}
+	return c
+}
+
+// Read - read a key from the cache, like the package level Read without exact key expiration
+func (c *Cache[K, V]) Read(key K) (V, error) {
+	var zero V
+	k := c.keyToByte(key)
+	if len(k) == 0 {
+		return zero, errKeyNotFound
+	}
+	q := c.data[k[0]]
+	q.RLock()
+	v, ok := q.dataSets[key]
+	q.RUnlock()
+	if !ok {
+		return zero, errKeyNotFound
+	}
+	return v, nil
+}
+
+// Write - Write data to the cache
+func (c *Cache[K, V]) Write(key K, value V, ttl time.Duration) {
+	k := c.keyToByte(key)
+	if len(k) == 0 {
+		return
+	}
+	n := c.data[k[0]]
+	n.Lock()
+	_, exists := n.dataManagement[key]
+	if exists || n.keys < int(c.size.Load()) {
+		if n.dataSets == nil {
+			n.dataSets = make(map[K]V)
+			n.dataManagement = make(map[K]*data)
+		}
+		n.dataSets[key] = value
+		n.dataManagement[key] = &data{setTime: now(), ttl: ttl}
+		if !exists {
+			n.keys++
+		}
+	}
+	n.Unlock()
+}
+
+// Delete - Remove a key from the cache before its ttl expires
+func (c *Cache[K, V]) Delete(key K) error {
+	k := c.keyToByte(key)
+	if len(k) == 0 {
+		return errKeyNotFound
+	}
+	n := c.data[k[0]]
+	n.Lock()
+	if _, ok := n.dataManagement[key]; !ok {
+		n.Unlock()
+		return errKeyNotFound
+	}
+	delete(n.dataSets, key)
+	delete(n.dataManagement, key)
+	n.keys--
+	n.Unlock()
+	return nil
+}
+
+// Resize - Changes the max entries per partition, see the package level Resize
+func (c *Cache[K, V]) Resize(entries int) {
+	c.size.Store(int64(entries))
+}
+
+// Close - Stops the expire go routine of the cache, the data stays readable
+func (c *Cache[K, V]) Close() {
+	c.closeOnce.Do(func() {
+		close(c.done)
+	})
+}
+
+// expire - Removes expired data once per default expire interval, until Close or Shutdown is called
+func (c *Cache[K, V]) expire() {
+	defer expiring.Done()
+	t := time.NewTicker(defaultExpireInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-c.done:
+			return
+		case <-t.C:
+			c.sweep()
+		}
+	}
+}
+
+// sweep - Removes all expired data of the cache
+func (c *Cache[K, V]) sweep() {
+	for _, m := range c.data {
+		m.Lock()
+		for q, d := range m.dataManagement {
+			if d.expired() {
+				delete(m.dataSets, q)
+				delete(m.dataManagement, q)
+				m.keys--
+			}
+		}
+		m.Unlock()
+	}
+}
+
+// flush - Removes all data of the cache
+func (c *Cache[K, V]) flush() {
+	for _, m := range c.data {
+		m.Lock()
+		m.dataSets = nil
+		m.dataManagement = nil
+		m.keys = 0
+		m.Unlock()
+	}
+}
@@ -0,0 +1,51 @@
+package ttlcache
+
+import (
+	"fmt"
+	"time"
+)
+
+// Increment - Adds delta to the int64 value of a key under the partition lock and returns the new value, for counters like rate limits
+// A missing or expired key counts as 0 and is created with ttl. An existing key keeps its setTime and ttl, so a counter started at the
+// beginning of a window expires at its end however often it is incremented. A value of another type returns an error wrapping ErrTypeMismatch
+func Increment(key interface{}, delta int64, ttl time.Duration, masterKey string) (int64, error) {
+	z := lookup(masterKey)
+	if z == nil {
+		return 0, errCacheNotInitialized
+	}
+	n, key, err := z.writable(key)
+	if err != nil {
+		return 0, err
+	}
+	i, evicted, err := n.increment(key, delta, ttl, z.entries())
+	if evicted != nil {
+		z.evictedForRoom(evicted)
+	}
+	return i, err
+}
+
+// increment - The locked part of Increment, the deferred unlock releases the partition also when Clone or sizeof panics
+func (n *ttlManagement) increment(key interface{}, delta int64, ttl time.Duration, size int) (int64, []KV, error) {
+	n.Lock()
+	defer n.Unlock()
+	if n.frozen {
+		return 0, nil, ErrFrozen
+	}
+	v, ok := n.live(key)
+	if !ok || v == negative {
+		stored, evicted := n.store(key, n.prepare(delta), ttl, size)
+		if !stored {
+			return 0, evicted, errCapacityFull
+		}
+		return delta, evicted, nil
+	}
+	i, ok := v.(int64)
+	if !ok {
+		return 0, nil, fmt.Errorf("%w: expected int64, got %T", errTypeMismatch, v)
+	}
+	i += delta
+	if err := n.update(key, n.dataManagement[key], n.prepare(i)); err != nil {
+		return 0, nil, err
+	}
+	return i, nil, nil
+}
@@ -0,0 +1,178 @@
+package ttlcache
+
+import "time"
+
+// Keys - Returns all live keys of a masterKey, for debugging and cache warming
+// The result can be large, use KeysFunc to walk the keys without collecting them all
+func Keys(masterKey string) []interface{} {
+	var keys []interface{}
+	KeysFunc(masterKey, func(key interface{}) bool {
+		keys = append(keys, key)
+		return true
+	})
+	return keys
+}
+
+// KeysFunc - Calls fn for every live key of a masterKey until fn returns false, keys cached as missing (WriteMiss) are skipped
+// The keys of a partition are copied under its read lock and fn is called after unlocking, so fn may use the cache
+func KeysFunc(masterKey string, fn func(key interface{}) bool) {
+	z := lookup(masterKey)
+	if z == nil {
+		return
+	}
+	var keys []interface{}
+	for _, n := range z.data {
+		keys = keys[:0]
+		n.RLock()
+		for k, d := range n.dataManagement {
+			if !d.expired() && n.dataSets[k] != negative {
+				keys = append(keys, k)
+			}
+		}
+		n.RUnlock()
+		for _, k := range keys {
+			if !fn(k) {
+				return
+			}
+		}
+	}
+}
+
+// DeleteFunc - Removes all records of a masterKey whose key matches, returning the number removed
+// Partitions are locked one at a time and match runs under the lock: Keep it cheap and do not use the cache from it.
+// A panic of match reaches the caller after the partition is unlocked
+func DeleteFunc(masterKey string, match func(key interface{}) bool) int {
+	z := lookup(masterKey)
+	if z == nil {
+		return 0
+	}
+	count := 0
+	for _, n := range z.data {
+		removed := n.deleteFunc(match)
+		count += len(removed)
+		z.evicted(removed)
+	}
+	return count
+}
+
+// deleteFunc - The locked part of DeleteFunc for one partition, the deferred unlock releases the partition also when match panics
+func (n *ttlManagement) deleteFunc(match func(key interface{}) bool) (removed []KV) {
+	n.Lock()
+	defer n.Unlock()
+	for k := range n.dataManagement {
+		if match(k) {
+			if v, ok := n.remove(k); ok {
+				removed = append(removed, KV{k, v})
+			}
+		}
+	}
+	return removed
+}
+
+// Range - Calls fn for every live record of a masterKey with the time it has left, until fn returns false
+// Like KeysFunc the records of a partition are copied under its read lock and fn is called after unlocking. Range does not extend any ttl
+// and skips keys cached as missing by WriteMiss
+func Range(masterKey string, fn func(key, value interface{}, remaining time.Duration) bool) {
+	z := lookup(masterKey)
+	if z == nil {
+		return
+	}
+	type record struct {
+		key, value interface{}
+		remaining  time.Duration
+	}
+	var records []record
+	for _, n := range z.data {
+		records = records[:0]
+		n.RLock()
+		for k, d := range n.dataManagement {
+			if v := n.dataSets[k]; !d.expired() && v != negative {
+				records = append(records, record{k, v, d.remaining()})
+			}
+		}
+		n.RUnlock()
+		for _, r := range records {
+			if !fn(r.key, n.cloned(r.value), r.remaining) {
+				return
+			}
+		}
+	}
+}
+
+// ReadPartition - Returns all live records of one partition, read under a single read lock
+// For key layouts which deliberately share a partition, like a tenant id as first key byte. With the default 256 partitions the
+// partition is the first KeyToByte byte, with HashKeys, Partitioner or Partitions use PartitionOf to find it. partition ranges over all
+// partitions of the masterKey (0 to the Partitions count - 1), returns nil for a partition out of that range
+func ReadPartition(masterKey string, partition int) map[interface{}]interface{} {
+	z := lookup(masterKey)
+	if z == nil || partition < 0 || partition >= len(z.data) {
+		return nil
+	}
+	n := z.data[partition]
+	n.RLock()
+	records := make(map[interface{}]interface{}, len(n.dataSets))
+	for k, d := range n.dataManagement {
+		if v := n.dataSets[k]; !d.expired() && v != negative && n.valid(k, v) {
+			records[k] = v
+		}
+	}
+	n.RUnlock()
+	if n.clone != nil {
+		for k, v := range records {
+			records[k] = n.clone(v)
+		}
+	}
+	return records
+}
+
+// Refresh - Checks every live record of a masterKey against check, for periodic reconciliation with a backing store
+// check returns keep false to remove the record, or keep true with a new value to replace it (keeping its ttl), or with nil to leave it.
+// The records of a partition are copied under its read lock and check runs without lock, so it may be slow and use the cache.
+// A record written or deleted while check runs is left alone. With MaxBytes a new value not fitting the partition is not stored
+func Refresh(masterKey string, check func(key, value interface{}) (newValue interface{}, keep bool)) {
+	z := lookup(masterKey)
+	if z == nil {
+		return
+	}
+	type record struct {
+		key, value interface{}
+		d          *data
+		setTime    time.Time
+	}
+	var records []record
+	for _, n := range z.data {
+		records = records[:0]
+		n.RLock()
+		for k, d := range n.dataManagement {
+			if v := n.dataSets[k]; !d.expired() && v != negative {
+				records = append(records, record{k, v, d, d.setTime})
+			}
+		}
+		n.RUnlock()
+		for _, r := range records {
+			v, keep := check(r.key, n.cloned(r.value))
+			if keep && v == nil {
+				continue
+			}
+			var p prepared
+			if keep {
+				p = n.prepare(v)
+			}
+			n.Lock()
+			if n.dataManagement[r.key] != r.d || !r.d.setTime.Equal(r.setTime) {
+				n.Unlock()
+				continue
+			}
+			if !keep {
+				old, ok := n.remove(r.key)
+				n.Unlock()
+				if ok {
+					z.evicted([]KV{{r.key, old}})
+				}
+				continue
+			}
+			n.update(r.key, r.d, p)
+			n.Unlock()
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package ttlcache
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"reflect"
+	"sync"
+	"sync/atomic"
+)
+
+// StringKeys - KeyToByte implementation for string keys
+// Other key types panic in KeyToByte, like a failed type assertion in any implementation
+type StringKeys struct{}
+
+// KeyToByte - Returns the bytes of a string key
+func (StringKeys) KeyToByte(key interface{}) []byte {
+	return []byte(key.(string))
+}
+
+// DefaultKeys - KeyToByte implementation for string and integer keys, used by InitCache when no key functions are given
+// Strings give the same bytes as StringKeys. Integers are encoded little endian, so the lowest byte selects the partition and
+// sequential ids spread over all partitions. Other key types panic: Implement KeyToByte for them. A []byte can not be a key,
+// since slices can not be map keys, use string(b)
+type DefaultKeys struct{}
+
+// KeyToByte - Returns the bytes of a string or integer key
+func (DefaultKeys) KeyToByte(key interface{}) []byte {
+	switch k := key.(type) {
+	case string:
+		return []byte(k)
+	case int:
+		return binary.LittleEndian.AppendUint64(nil, uint64(k))
+	case int8:
+		return []byte{byte(k)}
+	case int16:
+		return binary.LittleEndian.AppendUint16(nil, uint16(k))
+	case int32:
+		return binary.LittleEndian.AppendUint32(nil, uint32(k))
+	case int64:
+		return binary.LittleEndian.AppendUint64(nil, uint64(k))
+	case uint:
+		return binary.LittleEndian.AppendUint64(nil, uint64(k))
+	case uint8:
+		return []byte{k}
+	case uint16:
+		return binary.LittleEndian.AppendUint16(nil, k)
+	case uint32:
+		return binary.LittleEndian.AppendUint32(nil, k)
+	case uint64:
+		return binary.LittleEndian.AppendUint64(nil, k)
+	}
+	panic(fmt.Sprintf("ttlcache: unsupported key type %T, implement KeyToByte for it", key))
+}
+
+// IntKeys, Int64Keys, Uint64Keys - KeyToByte implementations for integer keys of one type, without the type switch of DefaultKeys
+// The key is encoded little endian like DefaultKeys does, so sequential ids spread over all partitions. The returned slice is kept by
+// the caller, so it is a small allocation per call: A pooled buffer could never be returned to the pool safely
+type (
+	IntKeys    struct{}
+	Int64Keys  struct{}
+	Uint64Keys struct{}
+)
+
+// KeyToByte - Returns the little endian bytes of an int key
+func (IntKeys) KeyToByte(key interface{}) []byte {
+	return binary.LittleEndian.AppendUint64(make([]byte, 0, 8), uint64(key.(int)))
+}
+
+// KeyToByte - Returns the little endian bytes of an int64 key
+func (Int64Keys) KeyToByte(key interface{}) []byte {
+	return binary.LittleEndian.AppendUint64(make([]byte, 0, 8), uint64(key.(int64)))
+}
+
+// KeyToByte - Returns the little endian bytes of a uint64 key
+func (Uint64Keys) KeyToByte(key interface{}) []byte {
+	return binary.LittleEndian.AppendUint64(make([]byte, 0, 8), key.(uint64))
+}
+
+// checkKey - Rejects key kinds which break retrieval: Pointers and channels are compared by address, so only the same pointer
+// finds the data again, while funcs, maps and slices can not be used as map key at all
+// Safe keys are strings, numbers, bools and arrays or structs of those
+func checkKey(key interface{}) error {
+	if key == nil {
+		return errInvalidKey
+	}
+	switch k := reflect.TypeOf(key).Kind(); k {
+	case reflect.Pointer, reflect.UnsafePointer, reflect.Chan, reflect.Func, reflect.Map, reflect.Slice:
+		return fmt.Errorf("%w: %s key", errInvalidKey, k)
+	}
+	return nil
+}
+
+// hashability - Whether the values of a key type can be map keys
+type hashability uint8
+
+const (
+	// hashAlways - Every value of the type can be a map key
+	hashAlways hashability = iota
+	// hashNever - No value of the type can be a map key: Slices, maps, funcs and structs or arrays holding them
+	hashNever
+	// hashDynamic - The type holds interfaces, so it depends on the values stored in them
+	hashDynamic
+)
+
+// keyType - The hashability of a key type
+type keyType struct {
+	t reflect.Type
+	h hashability
+}
+
+var (
+	// keyTypes - The hashability per key type, reflect.Type to *keyType
+	keyTypes sync.Map
+	// lastKeyType - The key type checked last: Caches mostly use one key type, so this saves the lookup in keyTypes
+	lastKeyType atomic.Pointer[keyType]
+)
+
+// hashable - Reports if key can be used as map key: Hashing a slice, map or func (also inside a struct or array) panics the runtime
+// The basic key types are checked without reflection, other types once per type: Only values of types holding interfaces are
+// checked on every call, since the values in the interfaces decide
+func hashable(key interface{}) bool {
+	switch key.(type) {
+	case nil, string, bool, int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, uintptr, float32, float64, complex64, complex128:
+		return true
+	}
+	t := reflect.TypeOf(key)
+	kt := lastKeyType.Load()
+	if kt == nil || kt.t != t {
+		v, ok := keyTypes.Load(t)
+		if !ok {
+			v, _ = keyTypes.LoadOrStore(t, &keyType{t, hashabilityOf(t)})
+		}
+		kt = v.(*keyType)
+		lastKeyType.Store(kt)
+	}
+	switch kt.h {
+	case hashAlways:
+		return true
+	case hashNever:
+		return false
+	}
+	return reflect.ValueOf(key).Comparable()
+}
+
+// hashabilityOf - Determines the hashability of a type
+func hashabilityOf(t reflect.Type) hashability {
+	if !t.Comparable() {
+		return hashNever
+	}
+	switch t.Kind() {
+	case reflect.Interface:
+		return hashDynamic
+	case reflect.Array:
+		return hashabilityOf(t.Elem())
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			if hashabilityOf(t.Field(i).Type) == hashDynamic {
+				return hashDynamic
+			}
+		}
+	}
+	return hashAlways
+}
+
+// checkKeyBytes - Rejects a key for which KeyToByte returns different bytes on two calls: The write would select a partition
+// the reads of the same key do not look in, so the record can never be read back
+func (z *mainData) checkKeyBytes(key interface{}) error {
+	k1, _ := z.keyBytes(key)
+	k2, _ := z.keyBytes(key)
+	if !bytes.Equal(k1, k2) {
+		return fmt.Errorf("%w: KeyToByte is not deterministic", errInvalidKey)
+	}
+	return nil
+}
@@ -0,0 +1,37 @@
+package ttlcache
+
+import (
+	"log"
+	"sync/atomic"
+)
+
+// Logger - Destination of the log output of the cache, satisfied by the standard *log.Logger
+// Wrap a structured logger (slog, zap) in a type with this method to capture the cache logs in its pipeline
+type Logger interface {
+	Printf(format string, v ...interface{})
+}
+
+// loggerHolder - Wraps a Logger, since an atomic.Value needs the same concrete type on every store
+type loggerHolder struct {
+	Logger
+}
+
+// logger - The Logger set by SetLogger, unset means the standard logger
+var logger atomic.Value
+
+// SetLogger - Routes the log output of the cache (Stats and recovered sweep panics) to l, nil restores the standard logger
+func SetLogger(l Logger) {
+	if l == nil {
+		l = log.Default()
+	}
+	logger.Store(loggerHolder{l})
+}
+
+// logf - Logs through the Logger of SetLogger
+func logf(format string, v ...interface{}) {
+	if h, ok := logger.Load().(loggerHolder); ok {
+		h.Printf(format, v...)
+		return
+	}
+	log.Printf(format, v...)
+}
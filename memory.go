@@ -0,0 +1,58 @@
+package ttlcache
+
+import "runtime/metrics"
+
+// shedDivisor - With MemoryLimit every partition sheds one in shedDivisor of its records per sweep while the heap is over the limit
+const shedDivisor = 4
+
+// heapMetric - Bytes of live and unswept heap objects, read without stopping the world like runtime.ReadMemStats
+const heapMetric = "/memory/classes/heap/objects:bytes"
+
+// heapBytes - Current size of the heap objects of the process
+func heapBytes() uint64 {
+	s := []metrics.Sample{{Name: heapMetric}}
+	metrics.Read(s)
+	if s[0].Value.Kind() != metrics.KindUint64 {
+		return 0
+	}
+	return s[0].Value.Uint64()
+}
+
+// overMemoryLimit - Checks the heap against the MemoryLimit of the masterKey
+func (z *mainData) overMemoryLimit() bool {
+	return z.memoryLimit > 0 && heapBytes() > z.memoryLimit
+}
+
+// shed - Removes a share of the records of every partition to release memory (MemoryLimit), counted as evictions
+// With EvictLRU the least recently used records (of the lowest priority) go first, otherwise the records are picked at random
+func (z *mainData) shed() {
+	for _, n := range z.data {
+		var removed []KV
+		n.Lock()
+		count := (n.keys + shedDivisor - 1) / shedDivisor
+		if n.order != nil {
+			for ; count > 0; count-- {
+				e := n.victim(nil)
+				if e == nil {
+					break
+				}
+				if v, ok := n.remove(e.Value); ok {
+					removed = append(removed, KV{e.Value, v})
+				}
+			}
+		} else {
+			// Map iteration order is random, so this removes a random share of the records
+			for k := range n.dataManagement {
+				if count == 0 {
+					break
+				}
+				if v, ok := n.remove(k); ok {
+					removed = append(removed, KV{k, v})
+				}
+				count--
+			}
+		}
+		n.Unlock()
+		z.evictedForRoom(removed)
+	}
+}
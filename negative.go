@@ -0,0 +1,32 @@
+package ttlcache
+
+import "time"
+
+// negativeMarker - Type of the value of keys cached as missing, not zero sized so its pointer is unique
+type negativeMarker struct {
+	_ byte
+}
+
+var (
+	// negative - Value stored by WriteMiss
+	negative interface{} = &negativeMarker{}
+	// errNegativeCached - The key is cached as missing in the backing store
+	errNegativeCached = ErrNegativeCached
+)
+
+// WriteMiss - Caches that a key is missing in the backing store, usually with a shorter ttl than found values
+// Reads of the key return ErrNegativeCached until negativeTTL expires, so callers can skip querying the backing store again.
+// The record takes room in the partition and expires like any other record, but it is not a value: OnEvict, OnSweep, MaxBytes and Clone
+// never see it, and Exists, Keys and LenLive do not count it as live
+func WriteMiss(key interface{}, negativeTTL time.Duration, masterKey string) {
+	Write(key, negative, negativeTTL, masterKey)
+}
+
+// found - Converts a value read from the partition to the result of a read, returning errNegativeCached for keys cached as missing
+// Call it after unlocking, it runs the Clone function of the masterKey
+func (n *ttlManagement) found(v interface{}) (interface{}, error) {
+	if v == negative {
+		return nil, errNegativeCached
+	}
+	return n.cloned(v), nil
+}
@@ -0,0 +1,250 @@
+package ttlcache
+
+import "time"
+
+const (
+	// defaultExpireInterval - Time between two sweeps when no ExpireInterval option is given
+	defaultExpireInterval = 10 * time.Second
+	// defaultPartitions - Number of partitions when no Partitions option is given, one per value of the first key byte
+	defaultPartitions = 256
+)
+
+// Option - Optional configuration of a masterKey, passed to InitCache
+type Option func(*mainData)
+
+// ExpireInterval - Sets the time between two sweeps removing expired data of the masterKey (default 10 seconds)
+// A sweep only visits the records which are due, but locks every partition: Intervals shorter than a few ms will cost a lot of CPU
+func ExpireInterval(d time.Duration) Option {
+	return func(m *mainData) {
+		if d > 0 {
+			m.expireInterval = d
+		}
+	}
+}
+
+// EvictionPolicy - What a write of a new key does when its partition is full
+type EvictionPolicy int
+
+const (
+	// DropOnFull - The write is dropped, keeping the data already in the cache (default)
+	DropOnFull EvictionPolicy = iota
+	// EvictLRU - The least recently used key of the partition is evicted to make room for the write
+	// Reads have to take the full partition lock to track use, so reads no longer run in parallel within a partition
+	EvictLRU
+)
+
+// Eviction - Sets the eviction policy of the masterKey
+func Eviction(p EvictionPolicy) Option {
+	return func(m *mainData) {
+		m.eviction = p
+	}
+}
+
+// OnEvict - Registers a callback for every record removed from the masterKey by expiration, Delete, Flush or eviction
+// The callback runs outside of the partition lock, so it may use the cache itself. For expired records it runs on the expire go routine of
+// the masterKey, not on the goroutine of the caller which wrote the data: A slow callback delays the next sweep
+func OnEvict(fn func(key, value interface{})) Option {
+	return func(m *mainData) {
+		m.onEvict = fn
+	}
+}
+
+// OnSweep - Registers a callback receiving all records expired by a sweep of the masterKey in one batch, for bulk audit logging
+// It runs on the expire go routine after the sweep completed, outside of the partition locks, and only when records expired.
+// Records of the byte store are not included. OnEvict, when set, is still called per record during the sweep
+func OnSweep(fn func(masterKey string, expired []KV)) Option {
+	return func(m *mainData) {
+		m.onSweep = fn
+	}
+}
+
+// SizeMode - How the entries passed to InitCache are interpreted
+type SizeMode int
+
+const (
+	// PerPartition - entries is the max number of keys of every partition (256 unless set with Partitions), so the cache holds up to
+	// partitions*entries keys (default)
+	PerPartition SizeMode = iota
+	// TotalCache - entries is the max number of keys of the whole cache, divided (rounded up) over the partitions
+	// Since the budget is per partition, a skewed key distribution fills a partition before the cache holds entries keys
+	TotalCache
+)
+
+// Sizing - Sets how the entries passed to InitCache are interpreted
+func Sizing(s SizeMode) Option {
+	return func(m *mainData) {
+		m.sizing = s
+	}
+}
+
+// DefaultTTL - Sets the ttl used by WriteDefault, without it WriteDefault returns ErrNoDefaultTTL. NoExpiry is allowed
+func DefaultTTL(d time.Duration) Option {
+	return func(m *mainData) {
+		m.defaultTTL, m.hasDefaultTTL = d, true
+	}
+}
+
+// Partitions - Sets the number of partitions of the masterKey, rounded up to a power of two (default 256)
+// Fewer partitions save memory for tiny caches, more reduce lock contention on large machines.
+// With any count but 256 the partition is selected by a hash of the full KeyToByte output instead of its first byte
+func Partitions(n int) Option {
+	return func(m *mainData) {
+		if n <= 0 {
+			return
+		}
+		p := 1
+		for p < n {
+			p <<= 1
+		}
+		m.partitions = p
+	}
+}
+
+// HashKeys - Selects the partition by an FNV-1a hash of the full KeyToByte output, also with the default 256 partitions
+// Keys sharing a prefix (like "user:" keys or UUIDs) otherwise land in a few partitions, defeating the partitioning.
+// Costs a few ns per read and write for hashing the key
+func HashKeys() Option {
+	return func(m *mainData) {
+		m.hashed = true
+	}
+}
+
+// ByteKeys - Keys the partition maps by the string of the KeyToByte output instead of the key itself
+// Makes keys usable which can not be map keys (slices, structs holding slices), and keys equal by their bytes find the same record.
+// Costs a copy of the key bytes per record and per read or write. Functions returning keys (Keys, Range, OnEvict, ReadMulti and the
+// like) return that string instead of the key written. The byte store of WriteBytes keeps keying by the key itself
+func ByteKeys() Option {
+	return func(m *mainData) {
+		m.byteKeys = true
+	}
+}
+
+// KeyEncoder - Encodes keys with fn instead of KeyToByte, so a key which can not be encoded returns an error instead of panicking
+// Read, ReadExact, WriteChecked and PartitionOf return the error of fn, other functions treat the key as invalid like an empty KeyToByte
+// result. The key functions passed to InitCache are then only used when nil is passed, to keep existing implementations working
+func KeyEncoder(fn func(key interface{}) ([]byte, error)) Option {
+	return func(m *mainData) {
+		m.encode = fn
+	}
+}
+
+// Partitioner - Selects the partition of a key by fn applied to its KeyToByte output, masked to the number of partitions
+// For a hash of choice (like xxhash) when neither the first byte nor HashKeys spreads the keys evenly. fn runs on every read and write,
+// so keep it fast. Snapshots of Export and SnapshotGob hold keys, not partitions, so they can be restored with another partitioner.
+// The byte store keeps selecting its partition by the first key byte
+func Partitioner(fn func(k []byte) uint32) Option {
+	return func(m *mainData) {
+		m.partitioner = fn
+	}
+}
+
+// PartitionCounters - Makes every partition count its reads (Read and ReadExact) and writes, reported per partition by StatsSnapshot
+// To find partitions taking most of the traffic, for tuning KeyToByte or the partitioning. Costs an atomic add per read and write
+func PartitionCounters() Option {
+	return func(m *mainData) {
+		m.partitionCounters = true
+	}
+}
+
+// StrictKeys - Makes writes reject pointer, channel, func, map and slice keys, which can not be read back
+// Applies to every function storing a key, from Write to WriteBatch, GetOrSet, Increment and ReadThrough.
+// Also rejects keys for which KeyToByte returns different bytes on two calls, a broken implementation writing keys into the wrong partition.
+// Costs a reflection call and an extra KeyToByte call per write. Safe keys are strings, numbers, bools and arrays or structs of those
+func StrictKeys() Option {
+	return func(m *mainData) {
+		m.strictKeys = true
+	}
+}
+
+// CopyOnWrite - Makes Read lock free: Every partition publishes an immutable copy of its values after each change
+// Reads no longer wait for writers, at the cost of copying the partition on every write and delete. Batches (WriteBatch, DeleteMulti,
+// DeleteFunc, InvalidateTag) and the sweep copy it once per partition lock instead of once per record.
+// Only suited for read heavy caches with small partitions. Ignored with EvictLRU, which has to track use on every read
+func CopyOnWrite() Option {
+	return func(m *mainData) {
+		m.copyOnWrite = true
+	}
+}
+
+// MaxBytes - Limits the approximate memory use of the values of the masterKey, next to the max entries
+// sizeof returns the size of a value in bytes, the budget is divided (rounded up) over the partitions like TotalCache.
+// With EvictLRU a write evicts the least recently used keys until the value fits, otherwise a write not fitting is dropped
+func MaxBytes(total int, sizeof func(value interface{}) int) Option {
+	return func(m *mainData) {
+		m.maxBytes = total
+		m.sizeof = sizeof
+	}
+}
+
+// LazyExpire - Makes ReadExact remove an expired record it finds, freeing its room in the partition before the next sweep
+// The read then takes the full partition lock to remove the record, so reads of expired keys cost more and block other reads briefly
+func LazyExpire() Option {
+	return func(m *mainData) {
+		m.lazyExpire = true
+	}
+}
+
+// SweepWorkers - Sweeps up to n partitions in parallel, capped at GOMAXPROCS (default 1: one partition at a time)
+// Shortens the sweep of huge caches with a lot of expiring records. Every partition is swept by a single worker, so workers never wait for
+// each others locks, but an OnEvict callback can then run on several go routines at the same time
+func SweepWorkers(n int) Option {
+	return func(m *mainData) {
+		m.sweepWorkers = n
+	}
+}
+
+// Clone - Copies values with fn when they are written and before they are returned by a read
+// Without it the cache stores and returns the values themselves: Slices, maps and pointers are shared with every reader,
+// so a caller changing a value it read changes it for all readers (and races with them). Cloning costs a copy per read and write
+func Clone(fn func(value interface{}) interface{}) Option {
+	return func(m *mainData) {
+		m.clone = fn
+	}
+}
+
+// CopyOnRead - Makes ReadBytes return a copy of the stored bytes, so callers can change the result without corrupting the cache
+// Costs an allocation and copy per read, without it all readers share the stored slice
+func CopyOnRead() Option {
+	return func(m *mainData) {
+		m.copyOnRead = true
+	}
+}
+
+// MaxIdle - Makes records also expire when they are not read for d, next to their ttl: Whichever comes first
+// Records written with NoExpiry expire only by idle time. Every read stores its time atomically, under the read lock, which costs a few ns
+// per read. Ignores CopyOnWrite, since its lock free reads do not see the records. Like the ttl, Read honors the idle time up to one expire
+// interval late, ReadExact exactly
+func MaxIdle(d time.Duration) Option {
+	return func(m *mainData) {
+		m.maxIdle = d
+	}
+}
+
+// InitialCapacity - Sizes the maps of a partition for n records when its first record is written, capped at the max entries per partition
+// Saves rehashing while a partition fills up, at the cost of allocating the memory for n records up front. WarmUp allocates the
+// maps of all partitions right away instead, sized to the max entries
+func InitialCapacity(n int) Option {
+	return func(m *mainData) {
+		if n > 0 {
+			m.capacity = n
+		}
+	}
+}
+
+// MemoryLimit - Makes the sweep shed a quarter of the records of every partition while the heap of the process is over limit bytes
+// For caches of records which can be rebuilt, losing records under memory pressure instead of running out of memory. The heap is
+// process wide: Every masterKey with a MemoryLimit sheds, whatever its own share of the heap. Shedding is counted as evictions and
+// is checked once per expire interval, so it does not replace GOMEMLIMIT for short spikes
+func MemoryLimit(limit uint64) Option {
+	return func(m *mainData) {
+		m.memoryLimit = limit
+	}
+}
+
+// ExpiryJitter - Adds a random duration up to d to the ttl of every write (not to NoExpiry)
+// Keys written in a burst otherwise expire together and are removed in one large locked burst by a single sweep
+func ExpiryJitter(d time.Duration) Option {
+	return func(m *mainData) {
+		m.jitter = d
+	}
+}
@@ -0,0 +1,344 @@
+package ttlcache
+
+import (
+	"container/list"
+	"math/rand/v2"
+	"time"
+)
+
+const (
+	// compactMinPeak - Partitions which never held more keys than this are not compacted
+	compactMinPeak = 1024
+	// compactRatio - A partition is compacted when its peak is more than compactRatio times the keys it holds
+	compactRatio = 4
+)
+
+// live - Returns the value of an unexpired record, requires the caller to hold the (read) lock
+func (n *ttlManagement) live(key interface{}) (interface{}, bool) {
+	d := n.dataManagement[key]
+	if d == nil || d.expired() {
+		return nil, false
+	}
+	v := n.dataSets[key]
+	if !d.validated(v) {
+		return nil, false
+	}
+	return v, true
+}
+
+// valid - Runs the validator of a record, if any, requires the caller to hold the (read) lock
+func (n *ttlManagement) valid(key interface{}, v interface{}) bool {
+	if n.validators.Load() == 0 {
+		return true
+	}
+	d := n.dataManagement[key]
+	return d == nil || d.validated(v)
+}
+
+// validated - Runs the validator of a record (WriteValidated), a panic counts as invalid: The validator runs under the partition lock,
+// which the panic would otherwise leave locked for good
+func (d *data) validated(v interface{}) (ok bool) {
+	if d.extra == nil || d.extra.valid == nil {
+		return true
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			logf("recovered from panic in validator: %v", r)
+			ok = false
+		}
+	}()
+	return d.extra.valid(v)
+}
+
+// prepared - A value cloned (Clone) and measured (MaxBytes) for store or update
+type prepared struct {
+	value interface{}
+	size  int
+}
+
+// prepare - Clones and measures a value, call it before taking the partition lock: Clone and sizeof are user code, a panic in them
+// must not leave the partition locked. Keys cached as missing (WriteMiss) are neither cloned nor measured, the marker is internal
+func (n *ttlManagement) prepare(value interface{}) prepared {
+	if value == nil || value == negative {
+		return prepared{value: value}
+	}
+	p := prepared{value: n.cloned(value)}
+	if n.sizeof != nil {
+		p.size = n.sizeof(p.value)
+	}
+	return p
+}
+
+// store - Stores a prepared record when the partition has room for it or already holds the key, requires the caller to hold the lock
+// A write not stored for lack of room is counted in dropped. A frozen partition stores nothing
+// A nil value is never stored: Read can not tell it apart from a miss, so it would only take up room in the partition
+// Overwriting a key (expired or not) does not count as a new key. With EvictLRU the least recently used keys make room when the partition is full
+// (in keys or in bytes with MaxBytes), the evicted records are returned so the caller can hand them to the OnEvict callback after unlocking
+func (n *ttlManagement) store(key interface{}, p prepared, ttl time.Duration, size int) (bool, []KV) {
+	value := p.value
+	if value == nil || n.frozen {
+		return false, nil
+	}
+	if n.counting {
+		n.writes.Add(1)
+	}
+	var evicted []KV
+	d := n.dataManagement[key]
+	need, old := p.size, 0
+	if n.sizeof != nil {
+		if need > n.budget {
+			// Would not fit in an empty partition, so no use evicting anything
+			n.dropped++
+			return false, nil
+		}
+		if d != nil {
+			old = d.more().size
+		}
+	}
+	if d != nil && n.order != nil {
+		// The key is used by this write, so it is not evicted to make room for itself
+		n.order.MoveToFront(d.more().elem)
+	}
+	// By using n.keys instead of len(n.dataSets), a faster accesspath to statistics is used (impact not tested)
+	for (d == nil && n.keys >= size) || (n.sizeof != nil && n.byteSize-old+need > n.budget) {
+		if n.order == nil {
+			n.dropped++
+			return false, evicted
+		}
+		var self *list.Element
+		if d != nil {
+			self = d.more().elem
+		}
+		back := n.victim(self)
+		if back == nil {
+			n.dropped++
+			return false, evicted
+		}
+		k := back.Value
+		v, _ := n.remove(k)
+		evicted = append(evicted, KV{k, v})
+	}
+	if n.dataSets == nil {
+		n.dataSets = make(map[interface{}]interface{}, n.capacity)
+		n.dataManagement = make(map[interface{}]*data, n.capacity)
+	}
+	n.dataSets[key] = value
+	if d == nil {
+		d = &data{key: key}
+		n.dataManagement[key] = d
+		n.keys = n.keys + 1
+		n.peak = max(n.peak, n.keys)
+		if n.order != nil {
+			d.more().elem = n.order.PushFront(key)
+		}
+	} else {
+		if d.extra != nil && d.extra.valid != nil {
+			d.extra.valid = nil
+			n.validators.Add(-1)
+		}
+		n.untag(key, d)
+		n.prioritize(d, 0)
+	}
+	n.byteSize += need - old
+	if n.sizeof != nil {
+		d.more().size = need
+	}
+	d.setTime = now()
+	if n.idle > 0 {
+		e := d.more()
+		e.idle = n.idle
+		e.lastAccess.Store(d.setTime.UnixNano())
+	}
+	if ttl >= 0 && n.jitter > 0 {
+		// Spread the expiration of keys written together over several sweeps
+		ttl += rand.N(n.jitter)
+	}
+	d.ttl = ttl
+	n.schedule(d)
+	n.changed()
+	return true, evicted
+}
+
+// update - Replaces the value of a record by a prepared value keeping its setTime and ttl, requires the caller to hold the lock
+// Returns errCapacityFull when the value does not fit the byte budget of the partition (MaxBytes), ErrFrozen for a frozen partition
+func (n *ttlManagement) update(key interface{}, d *data, p prepared) error {
+	if n.frozen {
+		return ErrFrozen
+	}
+	if n.sizeof != nil {
+		e := d.more()
+		if n.byteSize-e.size+p.size > n.budget {
+			return errCapacityFull
+		}
+		n.byteSize += p.size - e.size
+		e.size = p.size
+	}
+	n.dataSets[key] = p.value
+	n.changed()
+	return nil
+}
+
+// compact - Rebuilds the maps of a partition holding far fewer keys than at its peak, requires the caller to hold the lock
+// Go maps do not shrink after deletes, so a partition filled by a traffic spike keeps that memory until its maps are copied.
+// Small partitions and moderate shrinking are left alone, so partitions going up and down in size are not copied over and over
+func (n *ttlManagement) compact() {
+	if n.frozen || n.peak < compactMinPeak || n.keys*compactRatio > n.peak {
+		return
+	}
+	size := max(n.keys, n.capacity)
+	dataSets := make(map[interface{}]interface{}, size)
+	for k, v := range n.dataSets {
+		dataSets[k] = v
+	}
+	dataManagement := make(map[interface{}]*data, size)
+	for k, d := range n.dataManagement {
+		dataManagement[k] = d
+	}
+	n.dataSets, n.dataManagement = dataSets, dataManagement
+	n.peak = n.keys
+}
+
+// remove - Removes a record and returns its value, requires the caller to hold the lock
+// Returns false when the key was not present or the partition is frozen, leaving the keys counter untouched
+func (n *ttlManagement) remove(key interface{}) (interface{}, bool) {
+	d, ok := n.dataManagement[key]
+	if !ok || n.frozen {
+		return nil, false
+	}
+	v := n.dataSets[key]
+	delete(n.dataSets, key)
+	delete(n.dataManagement, key)
+	if n.order != nil {
+		n.order.Remove(d.more().elem)
+	}
+	n.unschedule(d)
+	n.untag(key, d)
+	n.prioritize(d, 0)
+	if e := d.extra; e != nil {
+		n.byteSize -= e.size
+		if e.valid != nil {
+			n.validators.Add(-1)
+		}
+	}
+	n.keys--
+	n.changed()
+	return v, true
+}
+
+// changed - Marks the values as changed for lock free reads (CopyOnWrite), requires the caller to hold the lock
+// The values are published once by Unlock, so a batch of changes under one lock copies the partition once instead of once per record
+func (n *ttlManagement) changed() {
+	n.dirty = n.cow
+}
+
+// Unlock - Unlocks the partition, publishing its values first when they changed under the lock (CopyOnWrite)
+func (n *ttlManagement) Unlock() {
+	if n.dirty {
+		n.dirty = false
+		n.publish()
+	}
+	n.RWMutex.Unlock()
+}
+
+// publish - Publishes an immutable copy of the values for lock free reads, requires the caller to hold the lock
+// Every lock with changes copies the full partition: This is the write amplification paid for lock free reads
+func (n *ttlManagement) publish() {
+	if !n.cow {
+		return
+	}
+	m := make(map[interface{}]interface{}, len(n.dataSets))
+	for k, v := range n.dataSets {
+		m[k] = v
+	}
+	n.snapshot.Store(&m)
+}
+
+// used - Marks a key as most recently used when the partition tracks use or idle time, requires the caller to hold the lock
+// With only MaxIdle the read lock is enough, the time of use is stored atomically
+func (n *ttlManagement) used(key interface{}) {
+	if n.order == nil && n.idle == 0 {
+		return
+	}
+	d := n.dataManagement[key]
+	if d == nil {
+		return
+	}
+	// The records of partitions tracking use or idle time always have their extra fields, allocated by store
+	if n.order != nil {
+		n.order.MoveToFront(d.extra.elem)
+	}
+	if n.idle > 0 {
+		d.extra.lastAccess.Store(now().UnixNano())
+	}
+}
+
+// readUsed - Read for partitions tracking use, taking the full lock to mark the key as most recently used
+func (n *ttlManagement) readUsed(key interface{}, exact bool) (interface{}, error) {
+	n.Lock()
+	v := n.dataSets[key]
+	if v != nil && (!exact || !n.dataManagement[key].expired()) && n.valid(key, v) {
+		n.used(key)
+		n.Unlock()
+		return n.found(v)
+	}
+	n.Unlock()
+	return nil, errKeyNotFound
+}
+
+// victim - The record to evict first with EvictLRU: The least recently used one of the lowest priority, other than the record being
+// written (self). Without records with a priority this is the back of the order list, otherwise the full list is scanned.
+// Requires the caller to hold the lock
+func (n *ttlManagement) victim(self *list.Element) *list.Element {
+	var lowest *list.Element
+	for e := n.order.Back(); e != nil; e = e.Prev() {
+		if e == self {
+			continue
+		}
+		if n.prioritized == 0 {
+			return e
+		}
+		if lowest == nil || n.dataManagement[e.Value].priority() < n.dataManagement[lowest.Value].priority() {
+			lowest = e
+		}
+	}
+	return lowest
+}
+
+// prioritize - Sets the eviction priority of a record, requires the caller to hold the lock
+func (n *ttlManagement) prioritize(d *data, priority int) {
+	if d.priority() != 0 {
+		n.prioritized--
+	}
+	if priority != 0 {
+		n.prioritized++
+	}
+	if priority != 0 || d.extra != nil {
+		d.more().priority = priority
+	}
+}
+
+// cloned - Copies a value with the Clone function of the masterKey, if any
+func (n *ttlManagement) cloned(v interface{}) interface{} {
+	if n.clone == nil {
+		return v
+	}
+	return n.clone(v)
+}
+
+// readLock - Lock for reads marking keys as used: The read lock, or the full lock when the partition tracks use
+func (n *ttlManagement) readLock() {
+	if n.order != nil {
+		n.Lock()
+		return
+	}
+	n.RLock()
+}
+
+// readUnlock - Unlocks a readLock
+func (n *ttlManagement) readUnlock() {
+	if n.order != nil {
+		n.Unlock()
+		return
+	}
+	n.RUnlock()
+}
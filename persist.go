@@ -0,0 +1,152 @@
+package ttlcache
+
+import (
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+// exported - A record in the JSON export, with the ttl it had left at export time
+type exported struct {
+	Key       interface{}   `json:"key"`
+	Value     interface{}   `json:"value"`
+	Remaining time.Duration `json:"remaining"`
+}
+
+// Export - Serializes all live records of a masterKey to JSON, to survive a restart with Import. Keys cached as missing are not exported
+// Keys and values have to be JSON serializable, otherwise the error of encoding/json is returned
+func Export(masterKey string) ([]byte, error) {
+	z := lookup(masterKey)
+	if z == nil {
+		return nil, errCacheNotInitialized
+	}
+	var records []exported
+	for _, n := range z.data {
+		n.RLock()
+		for k, d := range n.dataManagement {
+			if v := n.dataSets[k]; !d.expired() && v != negative {
+				records = append(records, exported{k, v, d.remaining()})
+			}
+		}
+		n.RUnlock()
+	}
+	return json.Marshal(records)
+}
+
+// Import - Restores records from Export into a masterKey, every record gets the ttl it had left at export time
+// Keys and values are restored the way encoding/json decodes into interface{}: Numbers become float64 and structs become maps.
+// Import therefore only round trips caches with string keys and values of the JSON types, use SnapshotGob for other keys.
+// A key the key functions can not handle (like a float64 for DefaultKeys) returns an error wrapping ErrInvalidKey and nothing is imported
+func Import(data []byte, masterKey string) error {
+	z := lookup(masterKey)
+	if z == nil {
+		return errCacheNotInitialized
+	}
+	var records []exported
+	if err := json.Unmarshal(data, &records); err != nil {
+		return err
+	}
+	entries := make([]Entry, 0, len(records))
+	for _, r := range records {
+		if err := z.importable(r.Key); err != nil {
+			return err
+		}
+		entries = append(entries, Entry{r.Key, r.Value, r.Remaining})
+	}
+	WriteBatch(entries, masterKey)
+	return nil
+}
+
+// importable - Checks that a decoded key can be written, recovering the panic of a KeyToByte not handling its type
+func (z *mainData) importable(key interface{}) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%w: %v", errInvalidKey, r)
+		}
+	}()
+	_, _, err = z.writable(key)
+	if err != nil {
+		err = fmt.Errorf("%w: key %v", err, key)
+	}
+	return err
+}
+
+// snapshotted - A record in the gob snapshot
+type snapshotted struct {
+	Key     interface{}
+	Value   interface{}
+	SetTime time.Time
+	TTL     time.Duration
+}
+
+func init() {
+	gob.Register(snapshotted{})
+}
+
+// SnapshotGob - Writes all live records of a masterKey to w with encoding/gob, for callers controlling both ends of the snapshot
+// Keys cached as missing are not written
+// gob requires the concrete types of keys and values to be registered with gob.Register by the caller
+func SnapshotGob(masterKey string, w io.Writer) error {
+	z := lookup(masterKey)
+	if z == nil {
+		return errCacheNotInitialized
+	}
+	enc := gob.NewEncoder(w)
+	var records []snapshotted
+	for _, n := range z.data {
+		records = records[:0]
+		n.RLock()
+		for k, d := range n.dataManagement {
+			if v := n.dataSets[k]; !d.expired() && v != negative {
+				records = append(records, snapshotted{k, v, d.setTime, d.ttl})
+			}
+		}
+		n.RUnlock()
+		// Encode outside of the lock, w can be slow
+		for i := range records {
+			if err := enc.Encode(&records[i]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// RestoreGob - Restores the records of SnapshotGob into a masterKey, keeping their original setTime and ttl
+// Records whose ttl elapsed before the restore are skipped
+func RestoreGob(masterKey string, r io.Reader) error {
+	z := lookup(masterKey)
+	if z == nil {
+		return errCacheNotInitialized
+	}
+	size := z.entries()
+	dec := gob.NewDecoder(r)
+	for {
+		var s snapshotted
+		if err := dec.Decode(&s); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		d := data{setTime: s.SetTime, ttl: s.TTL}
+		n, key, err := z.writable(s.Key)
+		if err != nil || d.expired() {
+			continue
+		}
+		p := n.prepare(s.Value)
+		n.Lock()
+		ok, evicted := n.store(key, p, s.TTL, size)
+		if ok {
+			d := n.dataManagement[key]
+			d.setTime = s.SetTime
+			n.schedule(d)
+		}
+		n.Unlock()
+		if evicted != nil {
+			z.evictedForRoom(evicted)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+// Package prometheus exports the statistics of go-ttlcache masterKeys as prometheus metrics
+// It lives in its own package, so the cache itself has no dependency on the prometheus client
+//
+// Register the collector for the masterKeys to export:
+//
+//	prom.MustRegister(prometheus.NewCollector("sessions", "users"))
+package prometheus
+
+import (
+	prom "github.com/prometheus/client_golang/prometheus"
+
+	ttlcache "github.com/norbertvannobelen/go-ttlcache"
+)
+
+var (
+	keysDesc      = prom.NewDesc("ttlcache_keys", "Registered keys, including expired keys not yet removed", []string{"masterkey"}, nil)
+	hitsDesc      = prom.NewDesc("ttlcache_hits_total", "Reads finding the key", []string{"masterkey"}, nil)
+	missesDesc    = prom.NewDesc("ttlcache_misses_total", "Reads not finding the key", []string{"masterkey"}, nil)
+	evictionsDesc = prom.NewDesc("ttlcache_evictions_total", "Records evicted to make room for a write", []string{"masterkey"}, nil)
+	droppedDesc   = prom.NewDesc("ttlcache_dropped_writes_total", "Writes not stored since the partition was full", []string{"masterkey"}, nil)
+)
+
+// Collector - prometheus.Collector reading the typed stats snapshot of a set of masterKeys
+type Collector struct {
+	masterKeys []string
+}
+
+// NewCollector - Creates a collector for the given masterKeys
+func NewCollector(masterKeys ...string) *Collector {
+	return &Collector{masterKeys: masterKeys}
+}
+
+// Describe - Implements prometheus.Collector
+func (c *Collector) Describe(ch chan<- *prom.Desc) {
+	ch <- keysDesc
+	ch <- hitsDesc
+	ch <- missesDesc
+	ch <- evictionsDesc
+	ch <- droppedDesc
+}
+
+// Collect - Implements prometheus.Collector
+// Counters reset by ttlcache.ResetStats show up as counter resets
+func (c *Collector) Collect(ch chan<- prom.Metric) {
+	for _, k := range c.masterKeys {
+		s := ttlcache.StatsSnapshot(k)
+		ch <- prom.MustNewConstMetric(keysDesc, prom.GaugeValue, float64(s.Keys), k)
+		ch <- prom.MustNewConstMetric(hitsDesc, prom.CounterValue, float64(s.Hits), k)
+		ch <- prom.MustNewConstMetric(missesDesc, prom.CounterValue, float64(s.Misses), k)
+		ch <- prom.MustNewConstMetric(evictionsDesc, prom.CounterValue, float64(s.Evictions), k)
+		ch <- prom.MustNewConstMetric(droppedDesc, prom.CounterValue, float64(s.DroppedWrites), k)
+	}
+}
@@ -0,0 +1,81 @@
+package ttlcache
+
+import (
+	"fmt"
+	"time"
+)
+
+// call - A loader in flight for a key, waiters block on done
+// value is the prepared (cloned) value of loader, never handed out itself: Every caller gets its own copy with Clone
+type call struct {
+	done  chan struct{}
+	value interface{}
+	err   error
+}
+
+// result - The result of a call for one caller, with Clone a copy of its own like a read from the cache
+func (c *call) result(n *ttlManagement) (interface{}, error) {
+	if c.err != nil || c.value == nil {
+		return c.value, c.err
+	}
+	return n.cloned(c.value), nil
+}
+
+// ReadThrough - read a live key from the cache, or load, store and return it when it is missing
+// Concurrent misses on the same key are coalesced: loader runs once and all waiters get its result. Unlike GetOrSet the loader runs
+// outside of the partition lock, so a slow loader does not block other keys. An error of loader is returned to all waiters but not stored,
+// a panic in loader (or in Clone or sizeof for its value) is returned as error. With Clone every caller gets its own copy of the value
+func ReadThrough(key interface{}, masterKey string, ttl time.Duration, loader func() (interface{}, error)) (interface{}, error) {
+	z := lookup(masterKey)
+	if z == nil {
+		return nil, errCacheNotInitialized
+	}
+	n, key, err := z.writable(key)
+	if err != nil {
+		return nil, err
+	}
+	n.Lock()
+	if v, ok := n.live(key); ok {
+		n.used(key)
+		n.Unlock()
+		return n.found(v)
+	}
+	if c := n.inflight[key]; c != nil {
+		n.Unlock()
+		<-c.done
+		return c.result(n)
+	}
+	c := &call{done: make(chan struct{})}
+	if n.inflight == nil {
+		n.inflight = make(map[interface{}]*call)
+	}
+	n.inflight[key] = c
+	n.Unlock()
+
+	var p prepared
+	func() {
+		defer func() {
+			if r := recover(); r != nil {
+				c.err = fmt.Errorf("loader panic: %v", r)
+			}
+		}()
+		c.value, c.err = loader()
+		if c.err == nil {
+			p = n.prepare(c.value)
+			c.value = p.value
+		}
+	}()
+
+	var evicted []KV
+	n.Lock()
+	delete(n.inflight, key)
+	if c.err == nil {
+		_, evicted = n.store(key, p, ttl, z.entries())
+	}
+	n.Unlock()
+	close(c.done)
+	if evicted != nil {
+		z.evictedForRoom(evicted)
+	}
+	return c.result(n)
+}
@@ -0,0 +1,79 @@
+package ttlcache
+
+import (
+	"container/heap"
+	"time"
+)
+
+// expiryHeap - Records of a partition which expire, soonest expiry first, so the sweep only visits records which are due
+type expiryHeap []*data
+
+func (h expiryHeap) Len() int           { return len(h) }
+func (h expiryHeap) Less(i, j int) bool { return h[i].due < h[j].due }
+
+func (h expiryHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].slot = i + 1
+	h[j].slot = j + 1
+}
+
+func (h *expiryHeap) Push(x any) {
+	d := x.(*data)
+	d.slot = len(*h) + 1
+	*h = append(*h, d)
+}
+
+func (h *expiryHeap) Pop() any {
+	old := *h
+	d := old[len(old)-1]
+	old[len(old)-1] = nil
+	d.slot = 0
+	*h = old[:len(old)-1]
+	return d
+}
+
+// deadline - Time after which the record is expired, by its ttl or by MaxIdle when it is not read in the meantime
+// Returns false for records which do not expire
+func (d *data) deadline() (time.Time, bool) {
+	var t time.Time
+	ok := false
+	if d.ttl >= 0 {
+		t, ok = d.setTime.Add(d.ttl), true
+	}
+	if e := d.extra; e != nil && e.idle > 0 {
+		if i := time.Unix(0, e.lastAccess.Load()).Add(e.idle); !ok || i.Before(t) {
+			t, ok = i, true
+		}
+	}
+	return t, ok
+}
+
+// schedule - Puts a record in the expiry heap, or moves it after its setTime or ttl changed, requires the caller to hold the lock
+// Records without expiry are left out of the heap. Reads move the MaxIdle deadline without the lock, so a record can be due in the heap
+// while it is not expired: The sweep schedules it again
+func (n *ttlManagement) schedule(d *data) {
+	due, ok := d.deadline()
+	switch {
+	case !ok && d.slot > 0:
+		heap.Remove(&n.expiry, d.slot-1)
+	case !ok:
+	case d.slot > 0:
+		d.due = due.UnixNano()
+		heap.Fix(&n.expiry, d.slot-1)
+	default:
+		d.due = due.UnixNano()
+		heap.Push(&n.expiry, d)
+	}
+}
+
+// unschedule - Takes a record out of the expiry heap, requires the caller to hold the lock
+func (n *ttlManagement) unschedule(d *data) {
+	if d.slot > 0 {
+		heap.Remove(&n.expiry, d.slot-1)
+	}
+}
+
+// due - Checks if the first record of the expiry heap is expired at t, requires the caller to hold the (read) lock
+func (n *ttlManagement) due(t time.Time) bool {
+	return len(n.expiry) > 0 && n.expiry[0].due < t.UnixNano()
+}
@@ -0,0 +1,183 @@
+package ttlcache
+
+import "fmt"
+
+// CacheStats - Point in time statistics of a single masterKey
+type CacheStats struct {
+	// Keys - Total registered keys over all partitions
+	Keys int
+	// MaxSize - Configured max entries (per partition)
+	MaxSize int
+	// Partitions - Registered keys per partition
+	Partitions []int
+	// Sizes - Map size per partition
+	Sizes []int
+	// Hits, Misses - Results of Read and ReadExact since initialization or the last ResetStats, summed over the partitions
+	Hits   uint64
+	Misses uint64
+	// Evictions - Records evicted to make room for a write (EvictLRU)
+	Evictions uint64
+	// DroppedWrites - Writes not stored since their partition was full, a sign the cache is too small
+	DroppedWrites uint64
+	// DroppedNotifications - Expired keys not sent to a Subscribe channel since its buffer was full
+	DroppedNotifications uint64
+	// PartitionReads, PartitionWrites - Reads and writes per partition, nil without the PartitionCounters option
+	PartitionReads  []uint64
+	PartitionWrites []uint64
+}
+
+// StatsSnapshot - Typed statistics for a masterKey, usable for tests and metrics export
+// Every partition is read locked only for the time it takes to read its counters
+func StatsSnapshot(masterKey string) CacheStats {
+	var s CacheStats
+	z := lookup(masterKey)
+	if z == nil {
+		return s
+	}
+	s.MaxSize = z.entries()
+	s.Partitions = make([]int, len(z.data))
+	s.Sizes = make([]int, len(z.data))
+	s.Misses = z.misses.Load()
+	s.Evictions = z.evictions.Load()
+	s.DroppedNotifications = z.droppedNotifications.Load()
+	if z.partitionCounters {
+		s.PartitionReads = make([]uint64, len(z.data))
+		s.PartitionWrites = make([]uint64, len(z.data))
+	}
+	for i, m := range z.data {
+		s.Hits += m.hits.Load()
+		s.Misses += m.misses.Load()
+		if z.partitionCounters {
+			s.PartitionReads[i] = m.reads.Load()
+			s.PartitionWrites[i] = m.writes.Load()
+		}
+		m.RLock()
+		s.Partitions[i] = m.keys
+		s.Sizes[i] = len(m.dataSets)
+		s.DroppedWrites += m.dropped
+		m.RUnlock()
+		s.Keys += s.Partitions[i]
+	}
+	return s
+}
+
+// Stats - Internal statistics for performance analysis, logged per masterKey and partition
+// Stats reads the counters through StatsSnapshot, so it is safe to call under load: Each partition is read locked only briefly
+func Stats() {
+	m := ttlMem.Load()
+	if m == nil {
+		return
+	}
+	for k, v := range *m {
+		s := StatsSnapshot(k)
+		logf("Master key: %s, partitions %d", k, len(v.data))
+		for i := range s.Partitions {
+			logf("Key: %s, partition %d, size %d, registered keys %d", k, i, s.Sizes[i], s.Partitions[i])
+		}
+	}
+}
+
+// Len - Number of registered keys of a masterKey, including expired keys not yet removed by the sweep
+// Len reads one counter per partition: O(partitions)
+func Len(masterKey string) int {
+	z := lookup(masterKey)
+	if z == nil {
+		return 0
+	}
+	l := 0
+	for _, n := range z.data {
+		n.RLock()
+		l += n.keys
+		n.RUnlock()
+	}
+	return l
+}
+
+// Capacity - Registered keys and max entries of the partition key is written to, to check for room before computing a value
+// Capacity is per partition, so the answer only holds for key (and keys sharing its partition), not for the masterKey as a whole.
+// With EvictLRU a full partition still accepts writes by evicting. Returns 0, 0 for an unknown masterKey or an invalid key
+func Capacity(key interface{}, masterKey string) (used, max int) {
+	z := lookup(masterKey)
+	if z == nil {
+		return 0, 0
+	}
+	n, _ := z.partition(key)
+	if n == nil {
+		return 0, 0
+	}
+	n.RLock()
+	used = n.keys
+	n.RUnlock()
+	return used, z.entries()
+}
+
+// PartitionOf - Index of the partition key is stored in, to find hot partitions and validate a KeyToByte implementation
+// The index matches the order of the Partitions and Sizes of StatsSnapshot. Returns ErrInvalidKey when KeyToByte returns no bytes
+func PartitionOf(key interface{}, masterKey string) (int, error) {
+	z := lookup(masterKey)
+	if z == nil {
+		return 0, errCacheNotInitialized
+	}
+	k, err := z.keyBytes(key)
+	if err != nil {
+		return 0, err
+	}
+	if len(k) == 0 {
+		return 0, errInvalidKey
+	}
+	return int(z.index(k)), nil
+}
+
+// LenLive - Number of unexpired keys of a masterKey, not counting keys cached as missing (WriteMiss)
+// LenLive checks the ttl of every record: O(entries), so a lot slower than Len on large caches
+func LenLive(masterKey string) int {
+	z := lookup(masterKey)
+	if z == nil {
+		return 0
+	}
+	l := 0
+	for _, n := range z.data {
+		n.RLock()
+		for k, d := range n.dataManagement {
+			if !d.expired() && n.dataSets[k] != negative {
+				l++
+			}
+		}
+		n.RUnlock()
+	}
+	return l
+}
+
+// ResetStats - Sets the hit and miss counters of a masterKey to zero, to start a new measurement window
+func ResetStats(masterKey string) {
+	z := lookup(masterKey)
+	if z == nil {
+		return
+	}
+	z.misses.Store(0)
+	for _, n := range z.data {
+		n.hits.Store(0)
+		n.misses.Store(0)
+	}
+}
+
+// Verify - Checks the keys counter of every partition against the sizes of its maps, returns the discrepancies found
+// A debugging aid for tests and staging: An empty result means the counters are consistent. Every partition is read locked during its check
+func Verify(masterKey string) []string {
+	z := lookup(masterKey)
+	if z == nil {
+		return []string{fmt.Sprintf("Master key: %s, not initialized", masterKey)}
+	}
+	var problems []string
+	for i, n := range z.data {
+		n.RLock()
+		if n.keys != len(n.dataSets) || n.keys != len(n.dataManagement) {
+			problems = append(problems, fmt.Sprintf("Master key: %s, partition %d, registered keys %d, values %d, records %d", masterKey, i, n.keys, len(n.dataSets), len(n.dataManagement)))
+		}
+		if n.order != nil && n.order.Len() != len(n.dataManagement) {
+			problems = append(problems, fmt.Sprintf("Master key: %s, partition %d, use order %d, records %d", masterKey, i, n.order.Len(), len(n.dataManagement)))
+		}
+		n.RUnlock()
+	}
+	return problems
+}
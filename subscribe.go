@@ -0,0 +1,82 @@
+package ttlcache
+
+import "sync"
+
+// subscribeBuffer - Keys buffered per subscriber, notifications for a full buffer are dropped
+const subscribeBuffer = 1024
+
+// subscribers - Channels receiving the keys expired by the sweep of a masterKey
+// The sweep sends under the read lock, so Unsubscribe can not close a channel while it is sent to
+type subscribers struct {
+	sync.RWMutex
+	chans []chan interface{}
+}
+
+// Subscribe - Returns a channel receiving the key of every record the sweep of a masterKey expires, for refresh ahead patterns
+// The channel is buffered: When the consumer falls behind, notifications are dropped (counted in DroppedNotifications of StatsSnapshot)
+// instead of blocking the sweep. Call Unsubscribe to stop receiving. Returns nil for an unknown masterKey
+func Subscribe(masterKey string) <-chan interface{} {
+	z := lookup(masterKey)
+	if z == nil {
+		return nil
+	}
+	ch := make(chan interface{}, subscribeBuffer)
+	z.subscribers.Lock()
+	z.subscribers.chans = append(z.subscribers.chans, ch)
+	z.subscribers.Unlock()
+	return ch
+}
+
+// Unsubscribe - Stops notifications on a channel returned by Subscribe and closes it
+// The channel is also closed when the masterKey is dropped or reinitialized
+func Unsubscribe(masterKey string, ch <-chan interface{}) {
+	z := lookup(masterKey)
+	if z == nil {
+		return
+	}
+	z.subscribers.Lock()
+	for i, c := range z.subscribers.chans {
+		if c == ch {
+			z.subscribers.chans = append(z.subscribers.chans[:i], z.subscribers.chans[i+1:]...)
+			close(c)
+			break
+		}
+	}
+	z.subscribers.Unlock()
+}
+
+// subscribed - Checks if any channel subscribed to the expirations of the masterKey
+func (z *mainData) subscribed() bool {
+	z.subscribers.RLock()
+	n := len(z.subscribers.chans)
+	z.subscribers.RUnlock()
+	return n > 0
+}
+
+// notify - Sends the keys of expired records to the subscribers, without blocking on a full channel
+func (z *mainData) notify(kvs []KV) {
+	if len(kvs) == 0 {
+		return
+	}
+	z.subscribers.RLock()
+	for _, c := range z.subscribers.chans {
+		for _, kv := range kvs {
+			select {
+			case c <- kv.Key:
+			default:
+				z.droppedNotifications.Add(1)
+			}
+		}
+	}
+	z.subscribers.RUnlock()
+}
+
+// unsubscribeAll - Closes all subscribed channels, for a masterKey being dropped or reinitialized
+func (z *mainData) unsubscribeAll() {
+	z.subscribers.Lock()
+	for _, c := range z.subscribers.chans {
+		close(c)
+	}
+	z.subscribers.chans = nil
+	z.subscribers.Unlock()
+}
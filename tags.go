@@ -0,0 +1,84 @@
+package ttlcache
+
+import "time"
+
+// WriteTagged - Write data to the cache with tags, so groups of keys can be removed together with InvalidateTag
+// A later write of the key drops its tags, like it drops a validator
+func WriteTagged(key interface{}, value interface{}, ttl time.Duration, masterKey string, tags ...string) {
+	z := lookup(masterKey)
+	if z == nil {
+		return
+	}
+	n, key, err := z.writable(key)
+	if err != nil {
+		return
+	}
+	p := n.prepare(value)
+	n.Lock()
+	ok, evicted := n.store(key, p, ttl, z.entries())
+	if ok && len(tags) > 0 {
+		n.tag(key, n.dataManagement[key], tags)
+	}
+	n.Unlock()
+	if evicted != nil {
+		z.evictedForRoom(evicted)
+	}
+}
+
+// InvalidateTag - Removes all keys of a masterKey carrying tag, returns the number of removed keys
+// The partitions are locked one at a time, so a key tagged during the call may survive it
+func InvalidateTag(masterKey string, tag string) int {
+	z := lookup(masterKey)
+	if z == nil {
+		return 0
+	}
+	count := 0
+	for _, n := range z.data {
+		var removed []KV
+		n.Lock()
+		for key := range n.tags[tag] {
+			if value, ok := n.remove(key); ok {
+				count++
+				if z.onEvict != nil {
+					removed = append(removed, KV{key, value})
+				}
+			}
+		}
+		n.Unlock()
+		z.evicted(removed)
+	}
+	return count
+}
+
+// tag - Adds the tags of a record to the tag index of the partition, requires the caller to hold the lock
+func (n *ttlManagement) tag(key interface{}, d *data, tags []string) {
+	if n.tags == nil {
+		n.tags = make(map[string]map[interface{}]struct{})
+	}
+	for _, t := range tags {
+		keys := n.tags[t]
+		if keys == nil {
+			keys = make(map[interface{}]struct{})
+			n.tags[t] = keys
+		}
+		keys[key] = struct{}{}
+	}
+	e := d.more()
+	e.tags = append(e.tags, tags...)
+}
+
+// untag - Removes the tags of a record from the tag index of the partition, requires the caller to hold the lock
+func (n *ttlManagement) untag(key interface{}, d *data) {
+	if d.extra == nil {
+		return
+	}
+	for _, t := range d.extra.tags {
+		if keys := n.tags[t]; keys != nil {
+			delete(keys, key)
+			if len(keys) == 0 {
+				delete(n.tags, t)
+			}
+		}
+	}
+	d.extra.tags = nil
+}
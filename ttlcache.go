@@ -1,9 +1,11 @@
 package ttlcache
 
 import (
+	"container/list"
 	"errors"
-	"log"
+	"reflect"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -19,141 +21,1142 @@ type ttlManagement struct {
 	dataSets       map[interface{}]interface{}
 	dataManagement map[interface{}]*data
 	keys           int
+	// order - Keys from most to least recently used, only set when the masterKey uses EvictLRU
+	order *list.List
+	// sizeof, budget, byteSize - Approximate memory use of the values against the byte budget of the partition (MaxBytes)
+	sizeof   func(value interface{}) int
+	budget   int
+	byteSize int
+	// jitter - Max random time added to the ttl of a write (ExpiryJitter)
+	jitter time.Duration
+	// idle - Max time between two reads of a record before it expires, 0 without MaxIdle
+	idle time.Duration
+	// capacity - Size hint for the maps of the partition when its first record is stored (InitialCapacity)
+	capacity int
+	// clone - Copies values on write and read (Clone)
+	clone func(value interface{}) interface{}
+	// inflight - Loaders of ReadThrough running for keys of the partition
+	inflight map[interface{}]*call
+	// validators - Number of records with a validator, so reads only look for validators when there are any
+	validators atomic.Int32
+	// expiry - Records with a ttl ordered by expiry time, for the sweep
+	expiry expiryHeap
+	// tags - Keys of the partition per tag (WriteTagged)
+	tags map[string]map[interface{}]struct{}
+	// frozen - Records can not be stored or removed (Freeze)
+	frozen bool
+	// hits, misses - Read statistics, counted per partition so parallel reads of different partitions do not write one shared counter
+	hits   atomic.Uint64
+	misses atomic.Uint64
+	// counting, reads, writes - Reads and writes of the partition, only counted with PartitionCounters
+	counting bool
+	reads    atomic.Uint64
+	writes   atomic.Uint64
+	// peak - Most keys held since the maps were created, Go maps keep the memory of their peak size (compact)
+	peak int
+	// dropped - Writes not stored since the partition had no room for them, counted under the lock
+	dropped uint64
+	// prioritized - Number of records with an eviction priority other than 0 (WritePriority)
+	prioritized int
+	// cow - Values are also published as an immutable copy in snapshot, for lock free reads (CopyOnWrite)
+	cow      bool
+	snapshot atomic.Pointer[map[interface{}]interface{}]
+	// dirty - The values changed since they were last published, Unlock publishes them
+	dirty bool
 }
 
 type data struct {
 	setTime time.Time
 	ttl     time.Duration
+	// key, slot - The key of the record and its position in the expiry heap of the partition plus one, 0 when not in the heap
+	key  interface{}
+	slot int
+	// due - Time in ns the record was due for expiry when it was put in the expiry heap
+	due int64
+	// extra - The fields of the options in use, nil for records which use none
+	extra *dataExtra
 }
 
-type keySet struct {
-	m  *ttlManagement
-	k3 interface{}
+// dataExtra - The fields of a record only some options use, allocated on first use so records without them stay small
+type dataExtra struct {
+	// elem - Position of the key in the order list of the partition (EvictLRU)
+	elem *list.Element
+	// size - Approximate memory use of the value (MaxBytes)
+	size int
+	// valid - Optional check of the value on read (WriteValidated)
+	valid func(value interface{}) bool
+	// tags - Tags of the record (WriteTagged)
+	tags []string
+	// priority - Eviction priority of the record, lower priorities are evicted first (WritePriority)
+	priority int
+	// idle, lastAccess - Max time between two reads of the record and the time of its last read or write in ns (MaxIdle)
+	idle       time.Duration
+	lastAccess atomic.Int64
+}
+
+// more - The optional fields of a record, allocated on first use, requires the caller to hold the (write) lock
+func (d *data) more() *dataExtra {
+	if d.extra == nil {
+		d.extra = &dataExtra{}
+	}
+	return d.extra
+}
+
+// priority - Eviction priority of the record, 0 when it has none
+func (d *data) priority() int {
+	if d.extra == nil {
+		return 0
+	}
+	return d.extra.priority
+}
+
+// NoExpiry - ttl for records which live until they are deleted, any negative ttl has the same effect
+const NoExpiry time.Duration = -1
+
+// expired - Exact expiration check for a single record, by ttl or by MaxIdle
+func (d *data) expired() bool {
+	if d.ttl >= 0 && since(d.setTime) > d.ttl {
+		return true
+	}
+	e := d.extra
+	return e != nil && e.idle > 0 && since(time.Unix(0, e.lastAccess.Load())) > e.idle
+}
+
+// remaining - Time left before the record expires, NoExpiry for records which do not expire
+func (d *data) remaining() time.Duration {
+	if d.ttl < 0 {
+		return NoExpiry
+	}
+	return d.ttl - since(d.setTime)
+}
+
+// KV - A key and its value
+type KV struct {
+	Key   interface{}
+	Value interface{}
 }
 
 // mainData struct setup makes it possible to read the base (masterKey) only once, reducing the read time with a few ns/read
 type mainData struct {
+	masterKey string
 	functions ttlFunctions
-	// 256 memory partitions (1 byte)
-	data [256]*ttlManagement
+	// size - Max entries per partition, atomic since Resize changes it while writes read it
+	size atomic.Int64
+	// memory partitions, 256 (1 byte) unless set with the Partitions option
+	data []*ttlManagement
+	// mask - Selects the partition from the hash of the key when hashed is set, otherwise the first byte of the key is the partition
+	mask   uint32
+	hashed bool
+	// expireInterval - Time between two sweeps of the expire go routine of this masterKey
+	expireInterval time.Duration
+	// eviction - What a write does when a partition is full
+	eviction EvictionPolicy
+	// partitions - Number of partitions, a power of two
+	partitions int
+	// maxBytes, sizeof - Byte budget of the masterKey and the function measuring values (MaxBytes)
+	maxBytes int
+	sizeof   func(value interface{}) int
+	// jitter - Max random time added to the ttl of a write
+	jitter time.Duration
+	// copyOnWrite - Partitions publish immutable copies of their values for lock free reads
+	copyOnWrite bool
+	// strictKeys - Write rejects key kinds which can never be read back
+	strictKeys bool
+	// lazyExpire - ReadExact removes the expired records it finds
+	lazyExpire bool
+	// sweepWorkers - Max number of partitions swept in parallel
+	sweepWorkers int
+	// maxIdle - Records expire when not read for maxIdle
+	maxIdle time.Duration
+	// capacity - Initial map size per partition
+	capacity int
+	// memoryLimit - Heap size in bytes above which the sweep sheds records
+	memoryLimit uint64
+	// partitionCounters - Partitions count their reads and writes
+	partitionCounters bool
+	// byteKeys - The partition maps are keyed by the string of the KeyToByte output instead of the key (ByteKeys)
+	byteKeys bool
+	// encode - Encodes keys returning an error for keys which can not be encoded, replacing KeyToByte
+	encode func(key interface{}) ([]byte, error)
+	// partitioner - Maps the KeyToByte output to a partition, replacing the first byte or FNV-1a hash
+	partitioner func(k []byte) uint32
+	// clone - Copies values on write and read
+	clone func(value interface{}) interface{}
+	// copyOnRead - ReadBytes returns a copy of the stored bytes
+	copyOnRead bool
+	// sizing - How the entries of InitCache are interpreted
+	sizing SizeMode
+	// defaultTTL, hasDefaultTTL - ttl used by WriteDefault and if it is set, WriteDefault refuses to write without it
+	defaultTTL    time.Duration
+	hasDefaultTTL bool
+	// misses - Reads of keys without a partition (invalid keys), the reads of a partition are counted by the partition
+	misses atomic.Uint64
+	// evictions - Records evicted to make room for a write
+	evictions atomic.Uint64
+	// bytes - Parallel store for []byte values, see WriteBytes
+	bytes *Cache[interface{}, []byte]
+	// onEvict - Called for every record removed from the cache, outside of the partition lock
+	onEvict func(key, value interface{})
+	// frozen - The masterKey is read only and not swept (Freeze)
+	frozen atomic.Bool
+	// onSweep - Callback with all records expired by a sweep
+	onSweep func(masterKey string, expired []KV)
+	// subscribers - Channels notified of expired keys (Subscribe), droppedNotifications counts keys not sent for a full channel
+	subscribers          subscribers
+	droppedNotifications atomic.Uint64
+	// done is closed when the masterKey is reinitialized, stopping its expire go routine
+	done chan struct{}
+}
+
+// partition - Returns the partition a key is stored in and the key to use in its maps (ByteKeys)
+// The partition is nil when KeyToByte returns no data for the key (or KeyEncoder an error), or when the key can not be a map key
+func (z *mainData) partition(key interface{}) (*ttlManagement, interface{}) {
+	n, key, _ := z.locate(key)
+	return n, key
+}
+
+// writable - Returns the partition for a write of a key like partition, or why the key can not be stored
+// Every write goes through here, so StrictKeys rejects keys which can not be read back whatever function writes them
+func (z *mainData) writable(key interface{}) (*ttlManagement, interface{}, error) {
+	if z.strictKeys {
+		if err := checkKey(key); err != nil && !z.byteKeys {
+			return nil, key, err
+		}
+		if err := z.checkKeyBytes(key); err != nil {
+			return nil, key, err
+		}
+	}
+	return z.locate(key)
+}
+
+// locate - Returns the partition of a key and the key to use in its maps, the error tells why a key has no partition
+func (z *mainData) locate(key interface{}) (*ttlManagement, interface{}, error) {
+	k, err := z.keyBytes(key)
+	if err != nil {
+		return nil, key, err
+	}
+	if len(k) == 0 {
+		return nil, key, errInvalidKey
+	}
+	key, ok := z.mapKey(key, k)
+	if !ok {
+		return nil, key, errInvalidKey
+	}
+	return z.data[z.index(k)], key, nil
+}
+
+// mapKey - The key used in the partition maps: The key itself, or the string of its KeyToByte output with ByteKeys
+// Returns false for a key which would panic the map lookup (a slice, or a struct holding one), instead of crashing the caller
+func (z *mainData) mapKey(key interface{}, k []byte) (interface{}, bool) {
+	if z.byteKeys {
+		return string(k), true
+	}
+	return key, hashable(key)
+}
+
+// keyBytes - Encodes a key with the KeyEncoder of the masterKey, or with KeyToByte of its key functions
+func (z *mainData) keyBytes(key interface{}) ([]byte, error) {
+	if z.encode != nil {
+		return z.encode(key)
+	}
+	return z.functions.KeyToByte(key), nil
 }
 
+// entries - Max entries per partition
+func (z *mainData) entries() int {
+	return int(z.size.Load())
+}
+
+// perPartition - Max entries per partition for the entries passed to InitCache or Resize, depending on the Sizing
+func (z *mainData) perPartition(entries int) int {
+	if z.sizing == TotalCache {
+		// Round up, so every partition can hold at least one key
+		return (entries + len(z.data) - 1) / len(z.data)
+	}
+	return entries
+}
+
+// index - Returns the partition index for the KeyToByte output of a key
+func (z *mainData) index(k []byte) uint32 {
+	if z.partitioner != nil {
+		return z.partitioner(k) & z.mask
+	}
+	if z.hashed {
+		return fnv32a(k) & z.mask
+	}
+	return uint32(k[0])
+}
+
+// fnv32a - FNV-1a hash of the full key, inlined since hash/fnv allocates a hasher per call
+func fnv32a(k []byte) uint32 {
+	h := uint32(2166136261)
+	for _, c := range k {
+		h ^= uint32(c)
+		h *= 16777619
+	}
+	return h
+}
+
+// counted - Counts the result of a read as hit or miss
+func (n *ttlManagement) counted(v interface{}, err error) (interface{}, error) {
+	if err != nil {
+		n.misses.Add(1)
+	} else {
+		n.hits.Add(1)
+	}
+	return v, err
+}
+
+// evicted - Hands removed records to the OnEvict callback, must be called without holding a partition lock
+// Keys cached as missing are skipped, they have no value to hand over
+func (z *mainData) evicted(kvs []KV) {
+	if z.onEvict == nil {
+		return
+	}
+	for _, kv := range kvs {
+		if kv.Value != negative {
+			z.onEvict(kv.Key, kv.Value)
+		}
+	}
+}
+
+// evictedForRoom - Counts records evicted to make room for a write and hands them to the OnEvict callback
+func (z *mainData) evictedForRoom(kvs []KV) {
+	z.evictions.Add(uint64(len(kvs)))
+	z.evicted(kvs)
+}
+
+// Errors returned by the cache, exported for errors.Is checks
 var (
-	ttlMem         = make(map[string]*mainData) // Interface as a key might not be static: If a pointer is passed in, no-one will ever have the same pointer again.
-	masterSize     = make(map[string]int)
-	errKeyNotFound = errors.New("Key not found")
-	mutex          = &sync.RWMutex{}
+	// ErrKeyNotFound - The key is not in the cache, expired or invalid
+	ErrKeyNotFound = errors.New("Key not found")
+	// ErrCacheNotInitialized - The masterKey is not initialized
+	ErrCacheNotInitialized = errors.New("Cache not initialized")
+	// ErrCapacityFull - A write of a new key was dropped since its partition is full
+	ErrCapacityFull = errors.New("Partition full")
+	// ErrFrozen - The masterKey is frozen, so it can not be changed (Freeze)
+	ErrFrozen = errors.New("Cache frozen")
+	// ErrAlreadyInitialized - InitCache of a masterKey which is already initialized
+	ErrAlreadyInitialized = errors.New("Cache already initialized")
+	// ErrNilValue - A nil value can not be stored, reads could not tell it apart from a miss
+	ErrNilValue = errors.New("Nil value")
+	// ErrInvalidKey - The key can not be stored: KeyToByte returns no bytes, it can not be a map key or StrictKeys rejects it
+	ErrInvalidKey = errors.New("Invalid key")
+	// ErrNegativeCached - The key is cached as missing in the backing store (WriteMiss)
+	ErrNegativeCached = errors.New("Key cached as missing")
+	// ErrTypeMismatch - A typed read or Increment found a value of another type, returned wrapped with the type names
+	ErrTypeMismatch = errors.New("Type mismatch")
+	// ErrNoDefaultTTL - WriteDefault on a masterKey initialized without the DefaultTTL option
+	ErrNoDefaultTTL = errors.New("No default ttl")
 )
 
-func init() {
-	go expire()
+var (
+	// ttlMem is an immutable map of the masterKeys, replaced by a copy on init: Reads need no lock and do not race with a concurrent init
+	ttlMem                 atomic.Pointer[map[string]*mainData] // Interface as a key might not be static: If a pointer is passed in, no-one will ever have the same pointer again.
+	errKeyNotFound         = ErrKeyNotFound
+	errAlreadyInitialized  = ErrAlreadyInitialized
+	errCacheNotInitialized = ErrCacheNotInitialized
+	errNilValue            = ErrNilValue
+	errInvalidKey          = ErrInvalidKey
+	errCapacityFull        = ErrCapacityFull
+	mutex                  = &sync.RWMutex{}
+	// stop signals the expire go routines to return, expiring tracks the running ones
+	stop     = make(chan struct{})
+	stopOnce sync.Once
+	expiring sync.WaitGroup
+)
+
+// lookup - Returns the cache of a masterKey, nil when it is not initialized
+func lookup(masterKey string) *mainData {
+	if m := ttlMem.Load(); m != nil {
+		return (*m)[masterKey]
+	}
+	return nil
 }
 
 // InitCache - Stores config value entries for later use
-// InitCache has to be called for all used masterkeys at the start of the program since the rest of the program has no lock protection on the supposedly initialized slices
-func InitCache(entries int, masterKey string, k ttlFunctions) {
+// InitCache can be called at any time, also while other masterKeys are in use: The masterKeys are published as an immutable map
+// Returns ErrAlreadyInitialized, leaving the existing cache untouched, when the masterKey is already initialized
+// With k nil the cache uses DefaultKeys, so keys have to be strings or integers
+func InitCache(entries int, masterKey string, k ttlFunctions, opts ...Option) error {
 	mutex.Lock()
-	masterSize[masterKey] = entries
-	m := &mainData{}
-	ttlMem[masterKey] = m
-	md := m.data
-	for i := 0; i <= 255; i++ {
-		md[i] = &ttlManagement{}
+	if lookup(masterKey) != nil {
+		mutex.Unlock()
+		return errAlreadyInitialized
 	}
-	m.data = md
-	m.functions = k
+	initCache(entries, masterKey, k, opts)
+	mutex.Unlock()
+	return nil
+}
+
+// ReInitCache - Resets the cache for a masterKey, dropping all data stored under it
+func ReInitCache(entries int, masterKey string, k ttlFunctions, opts ...Option) {
+	mutex.Lock()
+	if old := lookup(masterKey); old != nil {
+		close(old.done)
+		old.unsubscribeAll()
+	}
+	initCache(entries, masterKey, k, opts)
 	mutex.Unlock()
 }
 
-// Stats - Internal statistics for performance analysis
-func Stats() {
-	for k, v := range ttlMem {
-		log.Printf("Master key: %s, partitions %d", k, len(v.data))
-		for i, j := range v.data {
-			log.Printf("Key: %s, partition %d, size %d, registered keys %d", k, i, len(j.dataSets), j.keys)
+// DropCache - Removes a masterKey and stops its expire go routine, so all its memory can be garbage collected
+// Unlike Flush the masterKey is gone afterwards: Reads and writes return errCacheNotInitialized until it is initialized again
+func DropCache(masterKey string) {
+	mutex.Lock()
+	old := ttlMem.Load()
+	if old == nil || (*old)[masterKey] == nil {
+		mutex.Unlock()
+		return
+	}
+	close((*old)[masterKey].done)
+	(*old)[masterKey].unsubscribeAll()
+	caches := make(map[string]*mainData, len(*old))
+	for k, v := range *old {
+		if k != masterKey {
+			caches[k] = v
+		}
+	}
+	ttlMem.Store(&caches)
+	mutex.Unlock()
+}
+
+// Resize - Changes the max entries of a masterKey at runtime, interpreted like the entries of InitCache (see Sizing)
+// Growing takes effect for the next write. Shrinking below the keys a partition holds does not remove anything: A partition dropping
+// writes on full rejects new keys until expiration and deletes bring it below the new max, with EvictLRU the next write of a new key
+// evicts the partition down to it. Also resizes the byte store of the masterKey
+func Resize(masterKey string, entries int) error {
+	z := lookup(masterKey)
+	if z == nil {
+		return errCacheNotInitialized
+	}
+	size := z.perPartition(entries)
+	z.size.Store(int64(size))
+	z.bytes.Resize(size)
+	return nil
+}
+
+// initCache - Creates the partitions for a masterKey, requires the caller to hold the mutex
+func initCache(entries int, masterKey string, k ttlFunctions, opts []Option) {
+	m := &mainData{masterKey: masterKey, expireInterval: defaultExpireInterval, partitions: defaultPartitions, done: make(chan struct{})}
+	if k == nil {
+		k = DefaultKeys{}
+	}
+	m.functions = k
+	for _, o := range opts {
+		o(m)
+	}
+	md := make([]*ttlManagement, m.partitions)
+	for i := range md {
+		md[i] = &ttlManagement{}
+	}
+	m.data = md
+	m.mask = uint32(m.partitions - 1)
+	// With 256 partitions the first byte of the key selects the partition, any other count spreads the keys by a hash of the full key
+	m.hashed = m.hashed || m.partitions != defaultPartitions
+	size := m.perPartition(entries)
+	m.size.Store(int64(size))
+	m.bytes = newCache[interface{}, []byte](size, func(key interface{}) []byte {
+		k, _ := m.keyBytes(key)
+		return k
+	})
+	if m.eviction == EvictLRU {
+		for _, n := range m.data {
+			n.order = list.New()
+		}
+	} else if m.copyOnWrite && m.maxIdle == 0 {
+		for _, n := range m.data {
+			n.cow = true
 		}
 	}
+	for _, n := range m.data {
+		n.jitter = m.jitter
+		n.idle = m.maxIdle
+		n.counting = m.partitionCounters
+		n.capacity = max(min(m.capacity, size), 0)
+		n.clone = m.clone
+	}
+	if m.sizeof != nil {
+		for _, n := range m.data {
+			n.sizeof = m.sizeof
+			n.budget = (m.maxBytes + len(m.data) - 1) / len(m.data)
+		}
+	}
+	// Publish a copy of the masterKeys including the new one, the mutex serializes the copies
+	caches := make(map[string]*mainData)
+	if old := ttlMem.Load(); old != nil {
+		for k, v := range *old {
+			caches[k] = v
+		}
+	}
+	caches[masterKey] = m
+	ttlMem.Store(&caches)
+	expiring.Add(1)
+	go m.expire()
 }
 
 // Read - read a key from the cache, exact key expiration
 // With specific locking on the pointer, and with the array of pointers being static (read only after init), this code can be used for parallel reads with minimum blocking
 func Read(key interface{}, masterKey string) (interface{}, error) {
-	// To skip locking here requires essentially all cache masterkeys to be initialized (design trade off)
-	z := ttlMem[masterKey]
-	k := z.functions.KeyToByte(key)
-	if len(k) == 0 {
+	// The masterKeys are published as an immutable map, so no locking is required here
+	z := lookup(masterKey)
+	if z == nil {
+		return nil, errCacheNotInitialized
+	}
+	k, err := z.keyBytes(key)
+	if len(k) == 0 || err != nil {
+		z.misses.Add(1)
+		if err != nil {
+			return nil, err
+		}
 		return nil, errKeyNotFound
 	}
+	key, ok := z.mapKey(key, k)
+	if !ok {
+		z.misses.Add(1)
+		return nil, errInvalidKey
+	}
 	// With the lock at struct level, we lock only one pointer for the read operation, so no mutex required here: Gets the read time down with about 2-4ns/read
 	// Again, all slices need to be initialized to be allowed to lock this late
-	q := z.data[k[0]]
+	q := z.data[z.index(k)]
+	if q.counting {
+		q.reads.Add(1)
+	}
+	if q.cow && q.validators.Load() == 0 {
+		// The snapshot is never changed after publishing, so no lock is required at all
+		if m := q.snapshot.Load(); m != nil {
+			if v := (*m)[key]; v != nil {
+				q.hits.Add(1)
+				return q.found(v)
+			}
+		}
+		q.misses.Add(1)
+		return nil, errKeyNotFound
+	}
+	if q.order != nil {
+		// Keeping track of use changes the partition, so the LRU read can not run in parallel
+		return q.counted(q.readUsed(key, false))
+	}
 	q.RLock()
 	// while defer q.RUnlock() is go idiomatic and correct, it is slow: Timing of code using specific unlock at the independent locations improved 15ns per read
 	// We need a copy value of the data so that we can unlock the struct (so some overhead in memory management)
 	v := q.dataSets[key]
-	if v != nil {
+	if v != nil && q.valid(key, v) {
 		// Exact expiration adds about 22ns per read, so not used here (slight reduction off functionality vs arbitrary caching duration)
 		// if time.Since(v.setTime) > v.ttl {
 		// 	return nil, errKeyNotFound
 		// }
+		q.used(key)
+		q.RUnlock()
+		// The counters are atomic and per partition, so counting does not add lock contention
+		q.hits.Add(1)
+		return q.found(v)
+	}
+	q.RUnlock()
+	q.misses.Add(1)
+	return nil, errKeyNotFound
+}
+
+// ReadExact - read a key from the cache, honoring the exact ttl of the key
+// Costs about 22ns per read over Read, for callers which can not handle data up to one expire interval past its ttl
+func ReadExact(key interface{}, masterKey string) (interface{}, error) {
+	z := lookup(masterKey)
+	if z == nil {
+		return nil, errCacheNotInitialized
+	}
+	k, err := z.keyBytes(key)
+	if len(k) == 0 || err != nil {
+		z.misses.Add(1)
+		if err != nil {
+			return nil, err
+		}
+		return nil, errKeyNotFound
+	}
+	key, ok := z.mapKey(key, k)
+	if !ok {
+		z.misses.Add(1)
+		return nil, errInvalidKey
+	}
+	q := z.data[z.index(k)]
+	if q.counting {
+		q.reads.Add(1)
+	}
+	if q.order != nil {
+		v, err := q.readUsed(key, true)
+		if err == errKeyNotFound && z.lazyExpire {
+			z.reap(q, key)
+		}
+		return q.counted(v, err)
+	}
+	q.RLock()
+	v := q.dataSets[key]
+	d := q.dataManagement[key]
+	if v != nil && d != nil && !d.expired() && q.valid(key, v) {
+		q.used(key)
 		q.RUnlock()
-		return v, nil
+		q.hits.Add(1)
+		return q.found(v)
 	}
+	expired := d != nil && d.expired()
 	q.RUnlock()
+	if expired && z.lazyExpire {
+		z.reap(q, key)
+	}
+	q.misses.Add(1)
 	return nil, errKeyNotFound
 }
 
+// ReadOr - read a key from the cache like Read, returning def when the key is not found (or the masterKey not initialized)
+// For config style caches where a miss has a sensible default, Read stays the form to use when the reason of a miss matters
+func ReadOr(key interface{}, masterKey string, def interface{}) interface{} {
+	v, err := Read(key, masterKey)
+	if err != nil {
+		return def
+	}
+	return v
+}
+
+// reap - Removes a record found expired by a read, so its room in the partition is freed before the next sweep (LazyExpire)
+// The record is checked again under the full lock, it may have been written again after the read lock was released
+func (z *mainData) reap(n *ttlManagement, key interface{}) {
+	n.Lock()
+	d := n.dataManagement[key]
+	if d == nil || !d.expired() {
+		n.Unlock()
+		return
+	}
+	v, _ := n.remove(key)
+	n.Unlock()
+	z.evicted([]KV{{key, v}})
+}
+
 // Write - Write data to the cache
+// A write of a new key to a full partition is silently dropped, use WriteOK to detect this. Dropped writes are counted in the DroppedWrites of StatsSnapshot
 func Write(key interface{}, value interface{}, ttl time.Duration, masterKey string) {
+	WriteOK(key, value, ttl, masterKey)
+}
+
+// WriteOK - Write data to the cache, returns false when the value was not stored since the partition is full, the value is nil
+// or the key is invalid
+func WriteOK(key interface{}, value interface{}, ttl time.Duration, masterKey string) bool {
+	return WriteChecked(key, value, ttl, masterKey) == nil
+}
+
+// WriteChecked - Write data to the cache, returning why the value was not stored
+func WriteChecked(key interface{}, value interface{}, ttl time.Duration, masterKey string) error {
 	// Requirement: All slices are initialized: No locking required
-	z := ttlMem[masterKey]
-	n := z.data[z.functions.KeyToByte(key)[0]] // The given subindex (used to reduce lock contention on write)
-	// By using n.keys instead of len(n.dataSets), a faster accesspath to statistics is used (impact not tested)
+	z := lookup(masterKey)
+	if z == nil {
+		return errCacheNotInitialized
+	}
+	if value == nil {
+		return errNilValue
+	}
+	if z.frozen.Load() {
+		return ErrFrozen
+	}
+	n, key, err := z.writable(key) // The given subindex (used to reduce lock contention on write)
+	if err != nil {
+		return err
+	}
+	// Clone and sizeof are user code, so they run before the lock is taken
+	p := n.prepare(value)
 	// With the lock at struct level, we lock only one pointer for the slow operation
 	n.Lock()
-	if n.keys < masterSize[masterKey] {
-		if n.dataSets == nil {
-			n.dataSets = make(map[interface{}]interface{})
-			n.dataManagement = make(map[interface{}]*data)
-		}
-		n.dataSets[key] = value
-		n.dataManagement[key] = &data{setTime: time.Now(), ttl: ttl}
-		n.keys = n.keys + 1
+	ok, evicted := n.store(key, p, ttl, z.entries())
+	n.Unlock()
+	if evicted != nil {
+		z.evictedForRoom(evicted)
 	}
+	if !ok {
+		return errCapacityFull
+	}
+	return nil
+}
+
+// WriteDefault - Write data to the cache with the DefaultTTL of the masterKey
+// Without DefaultTTL nothing is written and ErrNoDefaultTTL is returned, other errors are those of WriteChecked
+func WriteDefault(key interface{}, value interface{}, masterKey string) error {
+	z := lookup(masterKey)
+	if z == nil {
+		return errCacheNotInitialized
+	}
+	if !z.hasDefaultTTL {
+		return ErrNoDefaultTTL
+	}
+	return WriteChecked(key, value, z.defaultTTL, masterKey)
+}
+
+// Exists - Check if a key is live in the cache without returning the value
+// Exists honors the exact expiration, so expired but not yet swept keys are reported as absent, like keys cached as missing (WriteMiss)
+func Exists(key interface{}, masterKey string) bool {
+	z := lookup(masterKey)
+	if z == nil {
+		return false
+	}
+	q, key := z.partition(key)
+	if q == nil {
+		return false
+	}
+	q.RLock()
+	v, ok := q.live(key)
+	q.RUnlock()
+	return ok && v != negative
+}
+
+// Delete - Remove a key from the cache before its ttl expires
+// Returns errKeyNotFound when the key was not present, so a double delete does not corrupt the keys counter
+func Delete(key interface{}, masterKey string) error {
+	z := lookup(masterKey)
+	if z == nil {
+		return errCacheNotInitialized
+	}
+	if z.frozen.Load() {
+		return ErrFrozen
+	}
+	n, key := z.partition(key)
+	if n == nil {
+		return errKeyNotFound
+	}
+	n.Lock()
+	v, ok := n.remove(key)
 	n.Unlock()
+	if !ok {
+		return errKeyNotFound
+	}
+	z.evicted([]KV{{key, v}})
+	return nil
 }
 
-// expire - Manages the expiration of data in the cache
-// expire is a go routine which once per time interval checks the state of the cache
-func expire() {
-	for {
-		time.Sleep(10 * time.Second)
-		var expiredData []*keySet
-		// Iterate over all cached sets using the TTL. Delete all expired records
-		for _, v := range ttlMem {
-			// Iterate over sub sets
-			for _, m := range v.data {
-				m.RLock()
-				// Iterate over stored record time
-				for q, t := range m.dataManagement {
-					// use time.Since since every ttl and setTime can be different
-					if time.Since(t.setTime) > t.ttl {
-						// Map has last been
-						expiredData = append(expiredData, &keySet{m, q})
-					}
-				}
-				m.RUnlock()
-			}
+// GetOrSet - Returns the live value of a key, or stores and returns the result of fn when there is none
+// fn is called at most once per key, since it runs under the partition lock: Keep fn fast, it blocks all access to the partition.
+// A panic of fn reaches the caller after the partition is unlocked.
+// When fn returns an error nothing is stored. When the partition is full or fn returns nil the value of fn is returned without storing it
+func GetOrSet(key interface{}, masterKey string, ttl time.Duration, fn func() (interface{}, error)) (interface{}, error) {
+	z := lookup(masterKey)
+	if z == nil {
+		return nil, errCacheNotInitialized
+	}
+	n, key, err := z.writable(key)
+	if err != nil {
+		return nil, err
+	}
+	v, live, evicted, err := n.getOrSet(key, ttl, z.entries(), fn)
+	if evicted != nil {
+		z.evictedForRoom(evicted)
+	}
+	if live {
+		return n.found(v)
+	}
+	return v, err
+}
+
+// getOrSet - The locked part of GetOrSet, the deferred unlock releases the partition also when fn, Clone or sizeof panics
+func (n *ttlManagement) getOrSet(key interface{}, ttl time.Duration, size int, fn func() (interface{}, error)) (v interface{}, live bool, evicted []KV, err error) {
+	n.Lock()
+	defer n.Unlock()
+	if v, ok := n.live(key); ok {
+		n.used(key)
+		return v, true, nil, nil
+	}
+	if v, err = fn(); err != nil {
+		return nil, false, nil, err
+	}
+	_, evicted = n.store(key, n.prepare(v), ttl, size)
+	return v, false, evicted, nil
+}
+
+// Touch - Resets the ttl of a live key without rewriting its value
+// Cheaper than a Write for sliding expiration, returns errKeyNotFound when the key is missing or expired
+func Touch(key interface{}, masterKey string, ttl time.Duration) error {
+	z := lookup(masterKey)
+	if z == nil {
+		return errCacheNotInitialized
+	}
+	n, key := z.partition(key)
+	if n == nil {
+		return errKeyNotFound
+	}
+	n.Lock()
+	if n.frozen {
+		n.Unlock()
+		return ErrFrozen
+	}
+	d := n.dataManagement[key]
+	if d == nil || d.expired() {
+		n.Unlock()
+		return errKeyNotFound
+	}
+	d.setTime = now()
+	d.ttl = ttl
+	n.schedule(d)
+	n.Unlock()
+	return nil
+}
+
+// ReadSliding - read a live key from the cache and restart its ttl, so keys which are read keep living while idle keys expire
+// Since the read changes the record, the full partition lock is taken: Expect a lot lower throughput than Read under parallel reads
+func ReadSliding(key interface{}, masterKey string, ttl time.Duration) (interface{}, error) {
+	z := lookup(masterKey)
+	if z == nil {
+		return nil, errCacheNotInitialized
+	}
+	n, key := z.partition(key)
+	if n == nil {
+		return nil, errKeyNotFound
+	}
+	n.Lock()
+	d := n.dataManagement[key]
+	if d == nil || d.expired() {
+		n.Unlock()
+		return nil, errKeyNotFound
+	}
+	if !n.frozen {
+		d.setTime = now()
+		d.ttl = ttl
+		n.schedule(d)
+	}
+	n.used(key)
+	v := n.dataSets[key]
+	n.Unlock()
+	return n.found(v)
+}
+
+// Flush - Removes all data of a masterKey, keeping the cache initialized
+// Partitions are locked one at a time, so reads on the other partitions continue during the flush
+func Flush(masterKey string) error {
+	z := lookup(masterKey)
+	if z == nil {
+		return errCacheNotInitialized
+	}
+	for _, n := range z.data {
+		var removed []KV
+		n.Lock()
+		if n.frozen {
+			n.Unlock()
+			return ErrFrozen
 		}
-		// Use the collected data in the expiredData array to delete all data from the ttlMem set which is expired
-		if len(expiredData) > 0 {
-			for _, v := range expiredData {
-				v.m.Lock()
-				delete(v.m.dataSets, v.k3)
-				delete(v.m.dataManagement, v.k3)
-				v.m.keys--
-				v.m.Unlock()
+		if z.onEvict != nil {
+			for k, v := range n.dataSets {
+				removed = append(removed, KV{k, v})
 			}
 		}
+		n.dataSets = nil
+		n.dataManagement = nil
+		n.keys = 0
+		n.peak = 0
+		n.expiry = nil
+		n.tags = nil
+		n.prioritized = 0
+		n.byteSize = 0
+		n.validators.Store(0)
+		if n.order != nil {
+			n.order.Init()
+		}
+		n.changed()
+		n.Unlock()
+		z.evicted(removed)
+	}
+	z.bytes.flush()
+	return nil
+}
+
+// Replace - Overwrites the value of a live key, keeping its setTime and ttl so the key ages as if it was not written
+// Returns errKeyNotFound when the key is missing or expired, a nil value is rejected since it can not be read.
+// With MaxBytes a value not fitting the byte budget of the partition returns errCapacityFull, Replace does not evict
+func Replace(key interface{}, value interface{}, masterKey string) error {
+	if value == nil {
+		return errNilValue
+	}
+	z := lookup(masterKey)
+	if z == nil {
+		return errCacheNotInitialized
+	}
+	n, key := z.partition(key)
+	if n == nil {
+		return errKeyNotFound
+	}
+	p := n.prepare(value)
+	n.Lock()
+	if _, ok := n.live(key); !ok {
+		n.Unlock()
+		return errKeyNotFound
+	}
+	err := n.update(key, n.dataManagement[key], p)
+	n.Unlock()
+	return err
+}
+
+// WriteIfAbsent - Write data to the cache only when the key has no live value, checked and written under one partition lock
+// An expired key not yet removed by the sweep counts as absent. Returns false when a live value exists or the value was not stored
+func WriteIfAbsent(key interface{}, value interface{}, ttl time.Duration, masterKey string) bool {
+	z := lookup(masterKey)
+	if z == nil {
+		return false
+	}
+	n, key, err := z.writable(key)
+	if err != nil {
+		return false
+	}
+	p := n.prepare(value)
+	n.Lock()
+	if _, ok := n.live(key); ok {
+		n.Unlock()
+		return false
+	}
+	ok, evicted := n.store(key, p, ttl, z.entries())
+	n.Unlock()
+	if evicted != nil {
+		z.evictedForRoom(evicted)
+	}
+	return ok
+}
+
+// WritePriority - Write data to the cache with an eviction priority, records written without priority have priority 0
+// With EvictLRU a full partition evicts the least recently used record of the lowest priority, so a high priority keeps small critical
+// records (like configuration) resident while churning records are evicted. Finding that record scans the use order of the partition,
+// so only partitions holding records with a priority pay for it. Without EvictLRU the priority has no effect. A later write of the key drops it
+func WritePriority(key interface{}, value interface{}, ttl time.Duration, masterKey string, priority int) {
+	z := lookup(masterKey)
+	if z == nil {
+		return
+	}
+	n, key, err := z.writable(key)
+	if err != nil {
+		return
+	}
+	p := n.prepare(value)
+	n.Lock()
+	ok, evicted := n.store(key, p, ttl, z.entries())
+	if ok {
+		n.prioritize(n.dataManagement[key], priority)
+	}
+	n.Unlock()
+	if evicted != nil {
+		z.evictedForRoom(evicted)
+	}
+}
+
+// WriteIfLonger - Write data to the cache only when it expires later than the live value of the key, checked and written under one partition lock
+// When writers race to cache a key, a fresh record is not shortened by a write with less ttl left. NoExpiry counts as the longest ttl,
+// so a live record without expiry is never replaced. Returns whether the value was stored
+func WriteIfLonger(key interface{}, value interface{}, ttl time.Duration, masterKey string) bool {
+	z := lookup(masterKey)
+	if z == nil {
+		return false
+	}
+	n, key, err := z.writable(key)
+	if err != nil {
+		return false
+	}
+	p := n.prepare(value)
+	n.Lock()
+	if _, ok := n.live(key); ok {
+		if left := n.dataManagement[key].remaining(); left < 0 || (ttl >= 0 && ttl <= left) {
+			n.Unlock()
+			return false
+		}
+	}
+	ok, evicted := n.store(key, p, ttl, z.entries())
+	n.Unlock()
+	if evicted != nil {
+		z.evictedForRoom(evicted)
+	}
+	return ok
+}
+
+// CompareAndSwap - Stores new with ttl only when the live value of the key equals old (reflect.DeepEqual), checked and written under one partition lock
+// Returns whether the swap happened. A missing or expired key never equals old, use WriteIfAbsent to create it
+func CompareAndSwap(key interface{}, old, new interface{}, ttl time.Duration, masterKey string) bool {
+	z := lookup(masterKey)
+	if z == nil {
+		return false
+	}
+	n, key, err := z.writable(key)
+	if err != nil {
+		return false
+	}
+	p := n.prepare(new)
+	n.Lock()
+	if v, ok := n.live(key); !ok || !reflect.DeepEqual(v, old) {
+		n.Unlock()
+		return false
+	}
+	ok, evicted := n.store(key, p, ttl, z.entries())
+	n.Unlock()
+	if evicted != nil {
+		z.evictedForRoom(evicted)
+	}
+	return ok
+}
+
+// ReadWithExpiry - read a live key from the cache together with the time it has left before expiring
+// remaining is NoExpiry for keys written with NoExpiry, expired keys return errKeyNotFound
+func ReadWithExpiry(key interface{}, masterKey string) (value interface{}, remaining time.Duration, err error) {
+	z := lookup(masterKey)
+	if z == nil {
+		return nil, 0, errCacheNotInitialized
+	}
+	n, key := z.partition(key)
+	if n == nil {
+		return nil, 0, errKeyNotFound
+	}
+	n.readLock()
+	value, ok := n.live(key)
+	if !ok {
+		n.readUnlock()
+		return nil, 0, errKeyNotFound
+	}
+	remaining = n.dataManagement[key].remaining()
+	n.used(key)
+	n.readUnlock()
+	if value, err = n.found(value); err != nil {
+		return nil, 0, err
+	}
+	return value, remaining, nil
+}
+
+// ReadStale - read a key from the cache including expired records not yet removed by the sweep, with stale true when the ttl passed
+// For serve stale while revalidate: Serve the stale value right away and refresh it in the background. The record is left in place
+func ReadStale(key interface{}, masterKey string) (value interface{}, stale bool, err error) {
+	z := lookup(masterKey)
+	if z == nil {
+		return nil, false, errCacheNotInitialized
+	}
+	n, key := z.partition(key)
+	if n == nil {
+		return nil, false, errKeyNotFound
+	}
+	n.readLock()
+	value = n.dataSets[key]
+	if value == nil || !n.valid(key, value) {
+		n.readUnlock()
+		return nil, false, errKeyNotFound
+	}
+	stale = n.dataManagement[key].expired()
+	n.used(key)
+	n.readUnlock()
+	if value, err = n.found(value); err != nil {
+		return nil, false, err
+	}
+	return value, stale, nil
+}
+
+// ReadStatus - Outcome of ReadDetailed
+type ReadStatus int
+
+const (
+	// Miss - The key is not in the cache (or cached as missing with WriteMiss)
+	Miss ReadStatus = iota
+	// Hit - The key was found within its ttl
+	Hit
+	// Expired - The key is still in the cache, but its ttl elapsed: It waits for the next sweep
+	Expired
+)
+
+// ReadDetailed - read a key from the cache with exact key expiration like ReadExact, telling an expired key apart from a miss
+// For cache analytics: Expired reads show keys missed by ttl timing instead of never being cached. Only a Hit returns the value
+func ReadDetailed(key interface{}, masterKey string) (value interface{}, status ReadStatus) {
+	z := lookup(masterKey)
+	if z == nil {
+		return nil, Miss
+	}
+	n, key := z.partition(key)
+	if n == nil {
+		z.misses.Add(1)
+		return nil, Miss
+	}
+	n.readLock()
+	value = n.dataSets[key]
+	d := n.dataManagement[key]
+	switch {
+	case value == nil || d == nil || value == negative || !n.valid(key, value):
+		status = Miss
+	case d.expired():
+		status = Expired
+	default:
+		status = Hit
+		n.used(key)
+	}
+	n.readUnlock()
+	if status != Hit {
+		if status == Expired && z.lazyExpire {
+			z.reap(n, key)
+		}
+		n.misses.Add(1)
+		return nil, status
+	}
+	n.hits.Add(1)
+	value, _ = n.found(value)
+	return value, Hit
+}
+
+// WarmUp - Creates the maps of all partitions of a masterKey up front, sized to the max entries per partition
+// Otherwise the first write to a partition creates its maps under the lock, giving that write a higher latency
+func WarmUp(masterKey string) error {
+	z := lookup(masterKey)
+	if z == nil {
+		return errCacheNotInitialized
+	}
+	size := z.entries()
+	for _, n := range z.data {
+		n.Lock()
+		if n.dataSets == nil {
+			n.dataSets = make(map[interface{}]interface{}, size)
+			n.dataManagement = make(map[interface{}]*data, size)
+		}
+		n.Unlock()
+	}
+	return nil
+}
+
+// WriteAndGet - Write data to the cache, returning the live value it replaced
+// The old value is read and the new one stored under one partition lock. existed is false when there was no live value
+func WriteAndGet(key interface{}, value interface{}, ttl time.Duration, masterKey string) (old interface{}, existed bool) {
+	z := lookup(masterKey)
+	if z == nil {
+		return nil, false
+	}
+	n, key, err := z.writable(key)
+	if err != nil {
+		return nil, false
+	}
+	p := n.prepare(value)
+	n.Lock()
+	old, existed = n.live(key)
+	if old == negative {
+		old, existed = nil, false
+	}
+	_, evicted := n.store(key, p, ttl, z.entries())
+	n.Unlock()
+	if evicted != nil {
+		z.evictedForRoom(evicted)
+	}
+	return old, existed
+}
+
+// WriteValidated - Write data to the cache with a validator, which is run on every read of the key
+// A read treats the key as missing when valid returns false, to invalidate records on external events before their ttl.
+// valid runs under the partition (read) lock: Keep it cheap and do not use the cache from it. A panic of valid counts as invalid.
+// A later write of the key drops the validator
+func WriteValidated(key interface{}, value interface{}, ttl time.Duration, masterKey string, valid func(value interface{}) bool) {
+	z := lookup(masterKey)
+	if z == nil {
+		return
+	}
+	n, key, err := z.writable(key)
+	if err != nil {
+		return
+	}
+	p := n.prepare(value)
+	n.Lock()
+	ok, evicted := n.store(key, p, ttl, z.entries())
+	if ok && valid != nil {
+		n.dataManagement[key].more().valid = valid
+		n.validators.Add(1)
+	}
+	n.Unlock()
+	if evicted != nil {
+		z.evictedForRoom(evicted)
 	}
 }
@@ -0,0 +1,508 @@
+package ttlcache
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"math/rand/v2"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+	"unsafe"
+)
+
+// initTest - Initializes a masterKey named after the test, dropped again when the test ends
+func initTest(t testing.TB, entries int, opts ...Option) string {
+	t.Helper()
+	masterKey := t.Name()
+	if err := InitCache(entries, masterKey, nil, opts...); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { DropCache(masterKey) })
+	return masterKey
+}
+
+// fakeClock - Replaces the clock for the test, the returned func moves it forward
+func fakeClock(t testing.TB) func(d time.Duration) {
+	t0 := time.Now()
+	var offset atomic.Int64
+	SetClock(func() time.Time { return t0.Add(time.Duration(offset.Load())) })
+	t.Cleanup(func() { SetClock(nil) })
+	return func(d time.Duration) { offset.Add(int64(d)) }
+}
+
+// sweep - Runs a sweep of masterKey, failing the test on an error
+func sweep(t *testing.T, masterKey string) {
+	t.Helper()
+	if err := Sweep(masterKey); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// verify - Fails the test when the keys counters of masterKey do not match its records
+func verify(t *testing.T, masterKey string) {
+	t.Helper()
+	for _, p := range Verify(masterKey) {
+		t.Error(p)
+	}
+}
+
+func TestEvictLRU(t *testing.T) {
+	masterKey := initTest(t, 2, Partitions(1), Eviction(EvictLRU))
+	Write(1, "a", time.Minute, masterKey)
+	Write(2, "b", time.Minute, masterKey)
+	if !WriteOK(3, "c", time.Minute, masterKey) {
+		t.Fatal("write to a full partition dropped with EvictLRU")
+	}
+	if _, err := Read(1, masterKey); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("oldest key not evicted: %v", err)
+	}
+	if v, err := Read(3, masterKey); v != "c" || err != nil {
+		t.Errorf("newest key not kept: %v, %v", v, err)
+	}
+	// Reading 2 makes 3 the least recently used key
+	Read(2, masterKey)
+	Write(4, "d", time.Minute, masterKey)
+	if Exists(3, masterKey) || !Exists(2, masterKey) || !Exists(4, masterKey) {
+		t.Errorf("read key evicted instead of the least recently used one: %v", Keys(masterKey))
+	}
+	if Len(masterKey) != 2 {
+		t.Errorf("len %d, want 2", Len(masterKey))
+	}
+	verify(t, masterKey)
+}
+
+func TestWriteNil(t *testing.T) {
+	masterKey := initTest(t, 10)
+	if err := WriteChecked(1, nil, time.Minute, masterKey); !errors.Is(err, ErrNilValue) {
+		t.Errorf("nil value: %v, want ErrNilValue", err)
+	}
+	Write(2, nil, time.Minute, masterKey)
+	if _, err := Read(2, masterKey); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("nil value read back: %v", err)
+	}
+	if Len(masterKey) != 0 {
+		t.Errorf("nil values take %d keys of the partitions", Len(masterKey))
+	}
+}
+
+// emptyKeys - Key functions returning no bytes for the empty string
+type emptyKeys struct{}
+
+func (emptyKeys) KeyToByte(key interface{}) []byte {
+	return []byte(key.(string))
+}
+
+func TestEmptyKeyBytes(t *testing.T) {
+	masterKey := t.Name()
+	if err := InitCache(10, masterKey, emptyKeys{}); err != nil {
+		t.Fatal(err)
+	}
+	defer DropCache(masterKey)
+	if err := WriteChecked("", "a", time.Minute, masterKey); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("empty key bytes: %v, want ErrInvalidKey", err)
+	}
+	// Must not panic
+	Write("", "a", time.Minute, masterKey)
+	if _, err := Read("", masterKey); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("read of empty key bytes: %v", err)
+	}
+	Write("b", "b", time.Minute, masterKey)
+	if v, err := Read("b", masterKey); v != "b" || err != nil {
+		t.Errorf("read: %v, %v", v, err)
+	}
+}
+
+func TestNoExpiry(t *testing.T) {
+	advance := fakeClock(t)
+	masterKey := initTest(t, 10)
+	Write(1, "a", NoExpiry, masterKey)
+	Write(2, "b", time.Minute, masterKey)
+	for range 3 {
+		advance(time.Hour)
+		sweep(t, masterKey)
+	}
+	if v, err := ReadExact(1, masterKey); v != "a" || err != nil {
+		t.Errorf("NoExpiry record expired: %v, %v", v, err)
+	}
+	if Exists(2, masterKey) || Len(masterKey) != 1 {
+		t.Errorf("record with a ttl survived the sweeps, len %d", Len(masterKey))
+	}
+}
+
+func TestWriteDefault(t *testing.T) {
+	advance := fakeClock(t)
+	masterKey := initTest(t, 10, DefaultTTL(time.Minute))
+	if err := WriteDefault(1, "a", masterKey); err != nil {
+		t.Fatal(err)
+	}
+	advance(30 * time.Second)
+	if v, err := ReadExact(1, masterKey); v != "a" || err != nil {
+		t.Errorf("read before the default ttl: %v, %v", v, err)
+	}
+	advance(31 * time.Second)
+	if _, err := ReadExact(1, masterKey); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("read after the default ttl: %v", err)
+	}
+	sweep(t, masterKey)
+	if Len(masterKey) != 0 {
+		t.Errorf("record with the default ttl not swept")
+	}
+
+	other := masterKey + "/none"
+	if err := InitCache(10, other, nil); err != nil {
+		t.Fatal(err)
+	}
+	defer DropCache(other)
+	if err := WriteDefault(1, "a", other); !errors.Is(err, ErrNoDefaultTTL) {
+		t.Errorf("WriteDefault without DefaultTTL: %v, want ErrNoDefaultTTL", err)
+	}
+	if Exists(1, other) {
+		t.Error("WriteDefault without DefaultTTL stored the record")
+	}
+}
+
+func TestExpireWithDelete(t *testing.T) {
+	advance := fakeClock(t)
+	masterKey := initTest(t, 1000, Partitions(4))
+	for i := range 1000 {
+		Write(i, i, time.Minute, masterKey)
+	}
+	advance(2 * time.Minute)
+	// Expired but not yet swept
+	for i := 0; i < 100; i++ {
+		Delete(i, masterKey)
+	}
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 100; i < 1000; i++ {
+			Delete(i, masterKey)
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for range 10 {
+			Sweep(masterKey)
+		}
+	}()
+	wg.Wait()
+	sweep(t, masterKey)
+	if Len(masterKey) != 0 {
+		t.Errorf("len %d after expiring and deleting all keys", Len(masterKey))
+	}
+	verify(t, masterKey)
+	// The counters must still allow filling the partitions
+	for i := range 1000 {
+		if err := WriteChecked(i, i, time.Minute, masterKey); err != nil {
+			t.Fatalf("write %d: %v", i, err)
+		}
+	}
+	verify(t, masterKey)
+}
+
+func TestExpiryJitter(t *testing.T) {
+	advance := fakeClock(t)
+	var mu sync.Mutex
+	var swept []int
+	masterKey := initTest(t, 1000, ExpiryJitter(time.Minute), OnSweep(func(_ string, expired []KV) {
+		mu.Lock()
+		swept = append(swept, len(expired))
+		mu.Unlock()
+	}))
+	const burst = 1000
+	for i := range burst {
+		Write(i, i, time.Minute, masterKey)
+	}
+	// Sweep every 10 seconds until past the ttl plus the max jitter
+	for range 13 {
+		advance(10 * time.Second)
+		sweep(t, masterKey)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	total, largest := 0, 0
+	for _, n := range swept {
+		total += n
+		largest = max(largest, n)
+	}
+	if total != burst {
+		t.Fatalf("%d records swept, want %d", total, burst)
+	}
+	if largest > burst/2 || len(swept) < 4 {
+		t.Errorf("burst not spread over the sweeps: %v", swept)
+	}
+}
+
+func TestCopyOnRead(t *testing.T) {
+	masterKey := initTest(t, 10, CopyOnRead())
+	WriteBytes(1, []byte("abc"), time.Minute, masterKey)
+	v, err := ReadBytes(1, masterKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v[0] = 'x'
+	if v, _ := ReadBytes(1, masterKey); !bytes.Equal(v, []byte("abc")) {
+		t.Errorf("cached bytes changed through a read: %q", v)
+	}
+
+	// Without CopyOnRead the stored slice is shared, as documented
+	shared := masterKey + "/shared"
+	if err := InitCache(10, shared, nil); err != nil {
+		t.Fatal(err)
+	}
+	defer DropCache(shared)
+	WriteBytes(1, []byte("abc"), time.Minute, shared)
+	v, _ = ReadBytes(1, shared)
+	v[0] = 'x'
+	if v, _ := ReadBytes(1, shared); !bytes.Equal(v, []byte("xbc")) {
+		t.Errorf("stored slice not shared without CopyOnRead: %q", v)
+	}
+}
+
+func TestMaxIdle(t *testing.T) {
+	advance := fakeClock(t)
+	masterKey := initTest(t, 10, MaxIdle(time.Minute))
+	Write(1, "idle", time.Hour, masterKey)
+	Write(2, "ttl", 90*time.Second, masterKey)
+	// Reads keep both records from idling out
+	for range 2 {
+		advance(40 * time.Second)
+		for _, k := range []int{1, 2} {
+			if _, err := Read(k, masterKey); err != nil {
+				t.Fatalf("read %d: %v", k, err)
+			}
+		}
+	}
+	// 120s: 2 passed its ttl although it was read 40s ago
+	advance(40 * time.Second)
+	if _, err := ReadExact(2, masterKey); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("record past its ttl: %v", err)
+	}
+	if _, err := ReadExact(1, masterKey); err != nil {
+		t.Errorf("read record idle for 40s: %v", err)
+	}
+	// 1 is not read for more than the max idle time, long before its ttl
+	advance(61 * time.Second)
+	if _, err := ReadExact(1, masterKey); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("idle record: %v", err)
+	}
+	sweep(t, masterKey)
+	if Len(masterKey) != 0 {
+		t.Errorf("len %d after sweeping both expiry triggers", Len(masterKey))
+	}
+}
+
+// TestInitCacheRace - Run with -race: Initializing masterKeys must not race with reads and writes of another masterKey
+func TestInitCacheRace(t *testing.T) {
+	masterKey := initTest(t, 1000)
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; ; i++ {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			Write(i%1000, i, time.Minute, masterKey)
+			Read(i%1000, masterKey)
+		}
+	}()
+	var inits sync.WaitGroup
+	for _, k := range []string{masterKey + "/a", masterKey + "/b"} {
+		inits.Add(1)
+		go func() {
+			defer inits.Done()
+			for i := range 50 {
+				if err := InitCache(10, k, nil); err != nil {
+					t.Error(err)
+					return
+				}
+				Write(i, i, time.Minute, k)
+				DropCache(k)
+			}
+		}()
+	}
+	inits.Wait()
+	close(stop)
+	wg.Wait()
+	verify(t, masterKey)
+}
+
+// realisticKeys - Random version 4 UUIDs and "user:" ids, half of each
+func realisticKeys(n int) []string {
+	r := rand.New(rand.NewPCG(1, 2))
+	keys := make([]string, n)
+	for i := range keys {
+		if i%2 == 0 {
+			keys[i] = fmt.Sprintf("user:%d", r.IntN(1e9))
+			continue
+		}
+		keys[i] = fmt.Sprintf("%08x-%04x-4%03x-%04x-%012x", r.Uint32(), r.Uint32()&0xffff, r.Uint32()&0xfff, r.Uint32()&0xffff, r.Uint64()&0xffffffffffff)
+	}
+	return keys
+}
+
+func TestPartitionerDistribution(t *testing.T) {
+	keys := realisticKeys(100000)
+	spread := func(masterKey string) (used, smallest, largest int) {
+		smallest = len(keys)
+		for _, n := range StatsSnapshot(masterKey).Partitions {
+			if n > 0 {
+				used++
+			}
+			smallest, largest = min(smallest, n), max(largest, n)
+		}
+		return used, smallest, largest
+	}
+	masterKey := initTest(t, len(keys), Partitioner(crc32.ChecksumIEEE))
+	firstByte := masterKey + "/first"
+	if err := InitCache(len(keys), firstByte, nil); err != nil {
+		t.Fatal(err)
+	}
+	defer DropCache(firstByte)
+	for _, k := range keys {
+		Write(k, k, time.Hour, masterKey)
+		Write(k, k, time.Hour, firstByte)
+	}
+	// The first bytes are "u" and the hex digits
+	if used, _, _ := spread(firstByte); used > 17 {
+		t.Errorf("first byte selection uses %d partitions, expected the key set to be skewed", used)
+	}
+	mean := len(keys) / defaultPartitions
+	used, smallest, largest := spread(masterKey)
+	if used != defaultPartitions || smallest < mean*7/10 || largest > mean*13/10 {
+		t.Errorf("uneven spread: %d partitions used, %d to %d keys per partition for a mean of %d", used, smallest, largest, mean)
+	}
+}
+
+// wallStep - t with its wall clock moved by d and its monotonic reading kept, like time.Now after the system clock is stepped
+// time.Time holds the seconds of the wall clock in bits 30-62 of its first word when it has a monotonic reading
+func wallStep(t time.Time, d time.Duration) time.Time {
+	*(*uint64)(unsafe.Pointer(&t)) += uint64(d/time.Second) << 30
+	return t
+}
+
+func TestSweepWallClockStep(t *testing.T) {
+	base := time.Now()
+	if s := wallStep(base, time.Hour); s.Sub(base) != 0 || s.UnixNano()-base.UnixNano() != int64(time.Hour) {
+		t.Skip("layout of time.Time changed, can not simulate a wall clock step")
+	}
+	var step atomic.Int64
+	SetClock(func() time.Time { return wallStep(base, time.Duration(step.Load())) })
+	defer SetClock(nil)
+	masterKey := initTest(t, 10)
+	Write(1, "a", 30*time.Minute, masterKey)
+	Write(2, "b", 2*time.Hour, masterKey)
+	step.Store(int64(time.Hour))
+	done := make(chan error)
+	go func() { done <- Sweep(masterKey) }()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("sweep did not return after the wall clock was stepped")
+	}
+	// The ttls follow the wall clock, like the expiry heap
+	if Exists(1, masterKey) || !Exists(2, masterKey) || Len(masterKey) != 1 {
+		t.Errorf("after a wall clock step of 1h: keys %v", Keys(masterKey))
+	}
+}
+
+func TestCopyOnWriteBatches(t *testing.T) {
+	advance := fakeClock(t)
+	masterKey := initTest(t, 1000, Partitions(1), CopyOnWrite())
+	entries := make([]Entry, 1000)
+	for k := range entries {
+		entries[k] = Entry{Key: k, Value: k, TTL: time.Duration(1+k%2) * time.Minute}
+	}
+	if n := WriteBatch(entries, masterKey); n != len(entries) {
+		t.Fatalf("%d of %d records stored", n, len(entries))
+	}
+	// The lock free reads see the records of the batch
+	for k := range entries {
+		if v, err := Read(k, masterKey); v != k || err != nil {
+			t.Fatalf("read %d after WriteBatch: %v, %v", k, v, err)
+		}
+	}
+	DeleteMulti([]interface{}{0, 1}, masterKey)
+	advance(90 * time.Second)
+	sweep(t, masterKey)
+	for k := range entries {
+		_, err := Read(k, masterKey)
+		if live := k > 1 && k%2 == 1; live != (err == nil) {
+			t.Errorf("read %d after DeleteMulti and the sweep: %v", k, err)
+		}
+	}
+}
+
+func TestReadThroughClone(t *testing.T) {
+	masterKey := initTest(t, 10, Clone(func(v interface{}) interface{} {
+		return append([]int(nil), v.([]int)...)
+	}))
+	const callers = 8
+	release := make(chan struct{})
+	results := make([][]int, callers)
+	var wg sync.WaitGroup
+	for i := range callers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			v, err := ReadThrough(1, masterKey, time.Minute, func() (interface{}, error) {
+				<-release
+				return []int{1, 2, 3}, nil
+			})
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			results[i] = v.([]int)
+		}()
+	}
+	// Let the callers coalesce on the loader
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	for i := range results {
+		for j := range i {
+			if &results[i][0] == &results[j][0] {
+				t.Fatalf("callers %d and %d share the loaded value", j, i)
+			}
+		}
+	}
+	results[0][0] = 42
+	if v, _ := Read(1, masterKey); v.([]int)[0] != 1 {
+		t.Errorf("cached value changed through the result of ReadThrough: %v", v)
+	}
+}
+
+func TestReadPartition(t *testing.T) {
+	masterKey := initTest(t, 100, Partitions(1024))
+	const keys = 5000
+	for k := range keys {
+		Write(k, k, time.Minute, masterKey)
+	}
+	reached := 0
+	for p := range 1024 {
+		for k, v := range ReadPartition(masterKey, p) {
+			if i, _ := PartitionOf(k, masterKey); i != p || k != v {
+				t.Fatalf("record %v: %v read from partition %d, stored in %d", k, v, p, i)
+			}
+			reached++
+		}
+	}
+	if reached != keys {
+		t.Errorf("%d of %d keys reached through ReadPartition", reached, keys)
+	}
+	if ReadPartition(masterKey, 1024) != nil || ReadPartition(masterKey, -1) != nil {
+		t.Error("records for a partition out of range")
+	}
+}
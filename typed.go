@@ -0,0 +1,41 @@
+package ttlcache
+
+import (
+	"fmt"
+	"reflect"
+	"time"
+)
+
+// errTypeMismatch - A typed read found a value of another type, the returned error wraps it with the type names
+var errTypeMismatch = ErrTypeMismatch
+
+// Typed - Type safe access to the values of a masterKey in the package level store
+// Unlike Cache it keeps the masterKey storage, so typed and untyped code can share a cache
+type Typed[V any] struct {
+	masterKey string
+}
+
+// New - Initializes a masterKey like InitCache and returns typed access to it
+func New[V any](entries int, masterKey string, k ttlFunctions, opts ...Option) (Typed[V], error) {
+	return Typed[V]{masterKey: masterKey}, InitCache(entries, masterKey, k, opts...)
+}
+
+// Read - read a key like Read, returning the zero value of V and errKeyNotFound on a miss
+// A value of another type, written through the untyped functions, returns an error wrapping ErrTypeMismatch instead of panicking
+func (t Typed[V]) Read(key interface{}) (V, error) {
+	var zero V
+	v, err := Read(key, t.masterKey)
+	if err != nil {
+		return zero, err
+	}
+	tv, ok := v.(V)
+	if !ok {
+		return zero, fmt.Errorf("%w: expected %s, got %T", errTypeMismatch, reflect.TypeOf((*V)(nil)).Elem(), v)
+	}
+	return tv, nil
+}
+
+// Write - Write data to the cache like Write
+func (t Typed[V]) Write(key interface{}, v V, ttl time.Duration) {
+	Write(key, v, ttl, t.masterKey)
+}